@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const maxSlowdown = 8
+
+// streamStats describe how well a client keeps up with its stream
+type streamStats struct {
+	Sent      uint64  `json:"sent"`      // messages written
+	Dropped   uint64  `json:"dropped"`   // frames replaced by a newer one before they were written
+	Unchanged uint64  `json:"unchanged"` // frames skipped in change mode
+	Bytes     uint64  `json:"bytes"`     // bytes written
+	Latency   float64 `json:"latency"`   // moving average of the time to write a message in ms
+	Slowdown  float64 `json:"slowdown"`  // factor applied to all channel intervals, 1 is full rate
+}
+
+// outbox holds the messages waiting for the writer. Replies and events are
+// queued, frames are kept per channel and replaced by newer ones, so a slow
+// client gets the latest frame instead of a growing backlog. Dropped frames
+// slow the client's channels down, fast writes speed them up again.
+type outbox struct {
+	mutex    sync.Mutex
+	queue    []message
+	frames   map[string]message
+	order    []string // channels with a pending frame, oldest first
+	ready    chan struct{}
+	stats    streamStats
+	interval time.Duration // shortest channel interval at full rate
+	pulled   int           // next commands with messages in the queue
+}
+
+func newOutbox() *outbox {
+	return &outbox{frames: map[string]message{}, ready: make(chan struct{}, 1), stats: streamStats{Slowdown: 1}}
+}
+
+// push adds a message, a pending frame of the same channel is dropped
+func (o *outbox) push(m message) {
+	o.mutex.Lock()
+	if m.pulled {
+		o.pulled++
+	}
+	if m.channel == "" {
+		o.queue = append(o.queue, m)
+	} else if _, ok := o.frames[m.channel]; ok {
+		o.stats.Dropped++
+		o.stats.Slowdown = minFloat(o.stats.Slowdown*1.5, maxSlowdown)
+		o.frames[m.channel] = m
+	} else {
+		o.frames[m.channel] = m
+		o.order = append(o.order, m.channel)
+	}
+	o.mutex.Unlock()
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the next message to write, queued messages first
+func (o *outbox) pop() (message, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if len(o.queue) > 0 {
+		m := o.queue[0]
+		o.queue = o.queue[1:]
+		if m.pulled {
+			o.pulled--
+		}
+		return m, true
+	}
+	if len(o.order) > 0 {
+		m := o.frames[o.order[0]]
+		delete(o.frames, o.order[0])
+		o.order = o.order[1:]
+		return m, true
+	}
+	return message{}, false
+}
+
+// written records a message the writer sent and how long it took
+func (o *outbox) written(m message, d time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	ms := float64(d) / float64(time.Millisecond)
+	if o.stats.Sent == 0 {
+		o.stats.Latency = ms
+	} else {
+		o.stats.Latency = 0.8*o.stats.Latency + 0.2*ms
+	}
+	o.stats.Sent++
+	o.stats.Bytes += uint64(len(m.data))
+	// recover the rate while writes take less than half of the current interval
+	current := float64(o.interval) * o.stats.Slowdown / float64(time.Millisecond)
+	if m.channel != "" && len(o.order) == 0 && o.stats.Latency*2 < current {
+		o.stats.Slowdown = maxFloat(o.stats.Slowdown*0.95, 1)
+	}
+}
+
+// slowdown returns the factor to apply to channel intervals and remembers the
+// shortest interval at full rate
+func (o *outbox) slowdown(interval time.Duration) float64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.interval = interval
+	return o.stats.Slowdown
+}
+
+// skipped counts a frame that wasn't sent because nothing changed
+func (o *outbox) skipped() {
+	o.mutex.Lock()
+	o.stats.Unchanged++
+	o.mutex.Unlock()
+}
+
+// pendingPulls returns the number of next commands whose messages wait for the writer
+func (o *outbox) pendingPulls() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.pulled
+}
+
+func (o *outbox) statistics() streamStats {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.stats
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
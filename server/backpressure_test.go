@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	o := newOutbox()
+	o.push(message{data: []byte("reply 1")})
+	o.push(message{channel: "frame", data: []byte("frame 1")})
+	o.push(message{channel: "depth", data: []byte("depth 1")})
+	o.push(message{channel: "frame", data: []byte("frame 2")})
+	o.push(message{data: []byte("reply 2")})
+
+	// replies first in order, then the latest frame per channel, oldest channel first
+	var got []string
+	for m, ok := o.pop(); ok; m, ok = o.pop() {
+		got = append(got, string(m.data))
+	}
+	want := []string{"reply 1", "reply 2", "frame 2", "depth 1"}
+	if len(got) != len(want) {
+		t.Fatalf("popped %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("popped %q, want %q", got, want)
+		}
+	}
+	if s := o.statistics(); s.Dropped != 1 || s.Slowdown != 1.5 {
+		t.Errorf("after one dropped frame %+v", s)
+	}
+}
+
+func TestOutboxSlowdown(t *testing.T) {
+	o := newOutbox()
+	o.slowdown(100 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		o.push(message{channel: "frame"})
+	}
+	if s := o.statistics(); s.Dropped != 19 || s.Slowdown != maxSlowdown {
+		t.Errorf("after 19 dropped frames %+v", s)
+	}
+	o.pop()
+	// fast writes recover the rate step by step, but not beyond full rate
+	for i := 0; i < 100; i++ {
+		o.written(message{channel: "frame", data: make([]byte, 10)}, time.Millisecond)
+	}
+	s := o.statistics()
+	if s.Slowdown != 1 || s.Sent != 100 || s.Bytes != 1000 || s.Latency < 0.99 || s.Latency > 1.01 {
+		t.Errorf("after fast writes %+v", s)
+	}
+	// slow writes don't
+	o.push(message{channel: "frame"})
+	o.push(message{channel: "frame"})
+	o.pop()
+	for i := 0; i < 10; i++ {
+		o.written(message{channel: "frame"}, time.Second)
+	}
+	if s := o.statistics(); s.Slowdown != 1.5 {
+		t.Errorf("after slow writes %+v", s)
+	}
+}
+
+func TestOutboxPendingPulls(t *testing.T) {
+	o := newOutbox()
+	o.push(message{data: []byte("frame")})
+	o.push(message{data: []byte("rgb"), pulled: true})
+	o.push(message{channel: "frame", data: []byte("frame")})
+	o.push(pullRequest{id: []byte("7")}.failed(errors.New("no device")))
+	if n := o.pendingPulls(); n != 1 {
+		t.Fatalf("%d pending pulls, want 1", n)
+	}
+	o.pop()
+	o.pop()
+	if n := o.pendingPulls(); n != 0 {
+		t.Errorf("%d pending pulls after writing the pull, want 0", n)
+	}
+	m, _ := o.pop()
+	if want := `{"reply":"next","id":7,"ok":false,"error":"no device"}`; string(m.data) != want {
+		t.Errorf("failed pull replied %s, want %s", m.data, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"sync"
+	"time"
+)
+
+// capturedFrame is one image taken by a captureLoop. Encoded JPEGs are cached
+// per quality so clients asking for the same quality share the work.
+type capturedFrame struct {
+	seq       uint64
+	taken     time.Time
+	timestamp uint32 // of the device
+	img       image.Image
+	mutex     sync.Mutex
+	jpegs     map[int][]byte
+}
+
+// jpeg returns the frame encoded with the given quality
+func (f *capturedFrame) jpeg(quality int) []byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if b, ok := f.jpegs[quality]; ok {
+		return b
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, f.img, &jpeg.Options{Quality: quality})
+	f.jpegs[quality] = buf.Bytes()
+	return f.jpegs[quality]
+}
+
+// captureLoop grabs frames of one type from the device while it has
+// subscribers, as fast as the fastest subscriber asks for
+type captureLoop struct {
+	capture func() (image.Image, uint32)
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	frame   *capturedFrame
+	seq     uint64
+	clients map[int]time.Duration
+	nextID  int
+	running bool
+}
+
+func newCaptureLoop(capture func() (image.Image, uint32)) *captureLoop {
+	l := &captureLoop{capture: capture, clients: map[int]time.Duration{}}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// captureLoops shared by all clients, by frame type
+var captureLoops = map[string]*captureLoop{
+	"rgb":   newCaptureLoop(func() (image.Image, uint32) { return freenect_device.RGBAFrameWithTimestamp() }),
+	"ir":    newCaptureLoop(func() (image.Image, uint32) { return freenect_device.IRFrameWithTimestamp() }),
+	"depth": newCaptureLoop(func() (image.Image, uint32) { return freenect_device.DepthFrameWithTimestamp() }),
+}
+
+// subscribe registers a client wanting a frame every interval and starts the loop if needed
+func (l *captureLoop) subscribe(interval time.Duration) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.nextID++
+	l.clients[l.nextID] = interval
+	if !l.running {
+		// subscribers entered deviceUsers, the loop ends after the last one left
+		l.running = true
+		deviceUsers.join()
+		go l.run()
+	}
+	return l.nextID
+}
+
+func (l *captureLoop) unsubscribe(id int) {
+	l.mutex.Lock()
+	delete(l.clients, id)
+	l.mutex.Unlock()
+}
+
+// interval returns the shortest interval requested, 0 if nobody is subscribed
+func (l *captureLoop) interval() time.Duration {
+	var min time.Duration
+	for _, d := range l.clients {
+		if min == 0 || d < min {
+			min = d
+		}
+	}
+	return min
+}
+
+func (l *captureLoop) run() {
+	for {
+		l.mutex.Lock()
+		interval := l.interval()
+		if interval == 0 {
+			l.running = false
+			l.frame = nil
+			l.mutex.Unlock()
+			deviceUsers.leave()
+			return
+		}
+		l.mutex.Unlock()
+
+		start := time.Now()
+		img, timestamp := l.capture()
+		l.mutex.Lock()
+		l.seq++
+		l.frame = &capturedFrame{seq: l.seq, taken: start, timestamp: timestamp, img: img, jpegs: map[int][]byte{}}
+		l.cond.Broadcast()
+		l.mutex.Unlock()
+
+		time.Sleep(interval - time.Since(start))
+	}
+}
+
+// recent returns the loop's frame if it was taken at most maxAge before t,
+// otherwise it captures one and hands it to the subscribers of a running
+// loop too, so a frame is read from the device once for both
+func (l *captureLoop) recent(t time.Time, maxAge time.Duration) *capturedFrame {
+	l.mutex.Lock()
+	if f := l.frame; f != nil && !f.taken.Before(t.Add(-maxAge)) {
+		l.mutex.Unlock()
+		return f
+	}
+	l.mutex.Unlock()
+
+	start := time.Now()
+	img, timestamp := l.capture()
+	f := &capturedFrame{taken: start, timestamp: timestamp, img: img, jpegs: map[int][]byte{}}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.running && (l.frame == nil || l.frame.taken.Before(start)) {
+		l.seq++
+		f.seq = l.seq
+		l.frame = f
+		l.cond.Broadcast()
+	}
+	return f
+}
+
+// next blocks until a frame newer than seq has been captured
+func (l *captureLoop) next(seq uint64) *capturedFrame {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for l.frame == nil || l.frame.seq <= seq {
+		l.cond.Wait()
+	}
+	return l.frame
+}
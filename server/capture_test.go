@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCaptureLoopRecent(t *testing.T) {
+	var captures int32
+	l := newCaptureLoop(func() (image.Image, uint32) {
+		return image.NewGray(image.Rect(0, 0, 1, 1)), uint32(atomic.AddInt32(&captures, 1))
+	})
+
+	// without a running loop every frame is captured and nothing is kept
+	a := l.recent(time.Now(), time.Minute)
+	b := l.recent(time.Now(), time.Minute)
+	if a.timestamp != 1 || b.timestamp != 2 || l.frame != nil {
+		t.Fatalf("captured %d and %d, kept %v", a.timestamp, b.timestamp, l.frame)
+	}
+
+	id := l.subscribe(time.Second)
+	looped := l.next(0)
+	n := atomic.LoadInt32(&captures)
+
+	// a recent frame of the loop is shared
+	if f := l.recent(time.Now(), time.Minute); f != looped || atomic.LoadInt32(&captures) != n {
+		t.Errorf("fresh loop frame not reused, %d captures", atomic.LoadInt32(&captures)-n)
+	}
+	// an old one is replaced for the loop's subscribers too
+	f := l.recent(time.Now().Add(time.Minute), time.Second)
+	if f == looped || atomic.LoadInt32(&captures) != n+1 {
+		t.Errorf("old loop frame reused, %d captures", atomic.LoadInt32(&captures)-n)
+	}
+	if next := l.next(looped.seq); next != f {
+		t.Errorf("captured frame %d not handed to the loop, got %d", f.seq, next.seq)
+	}
+
+	l.unsubscribe(id)
+	for i := 0; i < 300; i++ {
+		l.mutex.Lock()
+		running := l.running
+		l.mutex.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("loop still running")
+}
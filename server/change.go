@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// changeMode makes a stream skip frames while the sandbox doesn't change.
+// A frame is sent if any of the thresholds is reached compared to the frame a
+// channel sent last, 0 turns a threshold off.
+type changeMode struct {
+	On        bool    `json:"on"`
+	Height    float64 `json:"height"`    // mean absolute height delta in mm
+	Pixel     float64 `json:"pixel"`     // height delta in mm from which a pixel counts as changed
+	Pixels    int     `json:"pixels"`    // changed pixels
+	Circles   int     `json:"circles"`   // circles appeared or gone, with detection or the circles channel only
+	Heartbeat int     `json:"heartbeat"` // ms after which an unchanged frame is sent anyway
+}
+
+var defaultChangeMode = changeMode{Height: 1, Pixel: 5, Pixels: 500, Circles: 1, Heartbeat: 5000}
+
+// changeMetric is the difference of a frame to the one sent last
+type changeMetric struct {
+	Height  float64 `json:"height"`
+	Pixels  int     `json:"pixels"`
+	Circles int     `json:"circles"`
+}
+
+// sentFrame is what a channel sent last in change mode
+type sentFrame struct {
+	taken   time.Time
+	depth   []uint16
+	circles []circle
+}
+
+// exceeds reports whether a metric reaches any of the thresholds
+func (m changeMode) exceeds(c changeMetric) bool {
+	return (m.Height > 0 && c.Height >= m.Height) ||
+		(m.Pixels > 0 && c.Pixels >= m.Pixels) ||
+		(m.Circles > 0 && c.Circles >= m.Circles)
+}
+
+// changed decides whether a channel sends the frame of snap, last is nil if
+// it hasn't sent anything yet. The returned sentFrame replaces last if so.
+func (m changeMode) changed(last *sentFrame, snap *snapshot, detection bool) (*sentFrame, bool) {
+	current := &sentFrame{taken: snap.f.taken, depth: snap.f.depthArray16()}
+	if detection {
+		current.circles = snap.detect()
+	}
+	if last == nil || (m.Heartbeat > 0 && current.taken.Sub(last.taken) >= time.Duration(m.Heartbeat)*time.Millisecond) {
+		return current, true
+	}
+	metric := changeMetric{Circles: circleDifference(last.circles, current.circles)}
+	metric.Height, metric.Pixels = depthChange(last.depth, current.depth, snap.s.ROI, m.Pixel)
+	return current, m.exceeds(metric)
+}
+
+// depthChange returns the mean absolute delta in mm and the number of pixels
+// changed by more than pixel inside the region of interest. Pixels invalid in
+// either frame are left out.
+func depthChange(a, b []uint16, roi []int, pixel float64) (float64, int) {
+	var sum float64
+	n, changed := 0, 0
+	for i := range b {
+		if a[i] == 0 || b[i] == 0 || !inROI(roi, i%frameWidth, i/frameWidth) {
+			continue
+		}
+		d := math.Abs(float64(a[i]) - float64(b[i]))
+		sum += d
+		n++
+		if d > pixel {
+			changed++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), changed
+}
+
+// circleDifference counts the circles of a without a match in b and of b
+// without a match in a, circles match within their radius like the tracker's
+func circleDifference(a, b []circle) int {
+	n := 0
+	matched := make([]bool, len(b))
+	for _, c := range a {
+		found := false
+		for j, d := range b {
+			if !matched[j] && math.Hypot(float64(c.X-d.X), float64(c.Y-d.Y)) <= math.Max(float64(c.R), 10) {
+				matched[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			n++
+		}
+	}
+	for _, m := range matched {
+		if !m {
+			n++
+		}
+	}
+	return n
+}
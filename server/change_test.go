@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestDepthChange(t *testing.T) {
+	a := make([]uint16, frameWidth*frameHeight)
+	for i := range a {
+		a[i] = 1000
+	}
+	b := append([]uint16(nil), a...)
+	for x := 0; x < 10; x++ {
+		b[x] = 1010 // top row changed by 10 mm
+	}
+	b[frameWidth] = 0 // invalid pixels are left out
+	b[frameWidth+1] = 1003
+	valid := float64(frameWidth*frameHeight - 1)
+	tests := []struct {
+		name    string
+		roi     []int
+		pixel   float64
+		height  float64
+		changed int
+	}{
+		{"full frame", nil, 5, (100 + 3) / valid, 10},
+		{"small deltas count", nil, 2, (100 + 3) / valid, 11},
+		{"roi on the change", []int{0, 0, 10, 1}, 5, 10, 10},
+		{"roi beside it", []int{10, 0, 10, 10}, 0, 0, 0},
+		{"invalid only", []int{0, 1, 1, 1}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		height, changed := depthChange(a, b, tt.roi, tt.pixel)
+		if changed != tt.changed || height < tt.height-1e-9 || height > tt.height+1e-9 {
+			t.Errorf("%s: got %v mm and %d pixels, want %v and %d", tt.name, height, changed, tt.height, tt.changed)
+		}
+	}
+}
+
+func TestCircleDifference(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []circle
+		want int
+	}{
+		{"none", nil, nil, 0},
+		{"appeared", nil, []circle{{X: 10, Y: 10, R: 5}}, 1},
+		{"gone", []circle{{X: 10, Y: 10, R: 5}}, nil, 1},
+		{"moved within radius", []circle{{X: 100, Y: 100, R: 20}}, []circle{{X: 115, Y: 100, R: 20}}, 0},
+		{"small circle matches within 10 px", []circle{{X: 100, Y: 100, R: 2}}, []circle{{X: 108, Y: 100, R: 2}}, 0},
+		{"moved too far", []circle{{X: 100, Y: 100, R: 5}}, []circle{{X: 200, Y: 100, R: 5}}, 2},
+		{"one match each", []circle{{X: 0, Y: 0, R: 5}, {X: 2, Y: 0, R: 5}}, []circle{{X: 1, Y: 0, R: 5}}, 1},
+	}
+	for _, tt := range tests {
+		if got := circleDifference(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChangeModeExceeds(t *testing.T) {
+	m := changeMode{Height: 1, Pixels: 500, Circles: 1}
+	tests := []struct {
+		metric changeMetric
+		want   bool
+	}{
+		{changeMetric{}, false},
+		{changeMetric{Height: 0.5, Pixels: 499}, false},
+		{changeMetric{Height: 1}, true},
+		{changeMetric{Pixels: 500}, true},
+		{changeMetric{Circles: 1}, true},
+	}
+	for _, tt := range tests {
+		if got := m.exceeds(tt.metric); got != tt.want {
+			t.Errorf("%+v: got %v", tt.metric, got)
+		}
+	}
+	if (changeMode{}).exceeds(changeMetric{Height: 100, Pixels: 1e6, Circles: 10}) {
+		t.Error("thresholds of 0 are off")
+	}
+}
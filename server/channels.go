@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+)
+
+// snapshot is a client's view of a hub frame, filtered with its settings
+type snapshot struct {
+	s     *streamSettings
+	f     *hubFrame
+	depth []byte
+}
+
+// depthArray returns the filtered depth array
+func (snap *snapshot) depthArray() []byte {
+	if snap.depth == nil {
+		snap.depth = snap.s.Filter.apply(snap.f.depthArray())
+	}
+	return snap.depth
+}
+
+// detect returns the circles inside the region of interest with their depth
+func (snap *snapshot) detect() []circle {
+	var cs []circle
+	for _, circle := range snap.f.detect() {
+		if inROI(snap.s.ROI, circle.X, circle.Y) {
+			cs = append(cs, circle)
+		}
+	}
+	return cs
+}
+
+// jpegFrame encodes the region of interest of a frame image
+func (snap *snapshot) jpegFrame(frameType string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, cropImage(snap.f.image(frameType), snap.s.ROI), &jpeg.Options{Quality: image_quality})
+	return buf.Bytes(), err
+}
+
+// eventMessage tags an event for a stream
+type eventMessage struct {
+	Channel string `json:"ch"`
+	event
+}
+
+// statsMessage tags the stream statistics of a client
+type statsMessage struct {
+	Channel string `json:"ch"`
+	streamStats
+}
+
+// channel returns the encoded message of a subscribed channel, shared with
+// other clients of the same hub frame if possible
+func (s *streamSettings) channel(name string, snap *snapshot) (message, error) {
+	if key := s.cacheKey(name); key != "" {
+		return snap.f.message(key, func() (message, error) { return s.buildChannel(name, snap) })
+	}
+	return s.buildChannel(name, snap)
+}
+
+// pull builds one message per channel of a next command, they are queued
+// for the client and never dropped for a newer frame. The temporal filter
+// state is copied, pulled frames don't advance the smoothing of the stream.
+func (s streamSettings) pull(p pullRequest, f *hubFrame, stats streamStats) ([]message, error) {
+	s.Format = p.format
+	s.Filter.average = append([]float64(nil), s.Filter.average...)
+	snap := &snapshot{s: &s, f: f}
+	var messages []message
+	for _, name := range p.channels {
+		var m message
+		var err error
+		if name == channelStats {
+			m, err = encodeMessage(s.Format, statsMessage{Channel: channelStats, streamStats: stats})
+		} else {
+			m, err = s.channel(name, snap)
+		}
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// buildChannel builds and encodes the message of a subscribed channel
+func (s *streamSettings) buildChannel(name string, snap *snapshot) (message, error) {
+	p := payload{Channel: name}
+	var err error
+	var timestamp uint32
+	var units string
+	detected := false
+	switch name {
+	case channelFrame:
+		if frameType := streamTypes[s.Type]; frameType == "" {
+			p.Depthframe = cropArray(snap.depthArray(), s.ROI)
+			timestamp, units = snap.f.depth16Time, unitsDepthArray
+		} else if p.Depthframe, err = snap.jpegFrame(frameType); err != nil {
+			return message{}, err
+		} else {
+			timestamp, units = snap.f.imageTimestamp(frameType), unitsJPEG
+		}
+		if s.Detection {
+			p.Circles = snap.detect()
+			detected = true
+		}
+		if s.Terrain.enabled() {
+			s.Terrain.applyDepth(&p, snap.f.depthArray16())
+		}
+	case channelDepth:
+		p.Depthframe = cropArray(snap.depthArray(), s.ROI)
+		timestamp, units = snap.f.depth16Time, unitsDepthArray
+	case channelRGB, channelIR:
+		if p.Depthframe, err = snap.jpegFrame(name); err != nil {
+			return message{}, err
+		}
+		timestamp, units = snap.f.imageTimestamp(name), unitsJPEG
+	case channelCircles:
+		p.Circles = snap.detect()
+		timestamp, detected = snap.f.depth16Time, true
+	case channelContours:
+		interval := s.Terrain.Contours.Interval
+		if interval <= 0 {
+			interval = 10
+		}
+		h := newHeightfield(snap.f.depthArray16(), s.Terrain.Base)
+		p.Contours = contours(h, interval, s.Terrain.Contours.Start)
+		timestamp = snap.f.depth16Time
+	}
+
+	p.frameMeta = newFrameMeta(snap.f.taken, timestamp)
+	p.Seq = snap.f.seq
+	p.Filter = s.filterVersion()
+	if units != "" {
+		p.describe(s.ROI, units)
+	}
+	if detected {
+		p.Latency = milliseconds(snap.f.detectLatency)
+	}
+	return encodeMessage(s.Format, p)
+}
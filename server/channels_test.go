@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPullKeepsFilterState(t *testing.T) {
+	s := streamSettings{Channels: map[string]int{}, Type: "deptharray", Filter: depthFilter{Temporal: 0.5}, Format: formatJSON}
+	s.Filter.apply(make([]byte, frameWidth*frameHeight))
+	before := append([]float64(nil), s.Filter.average...)
+
+	f := &hubFrame{depth: make([]byte, frameWidth*frameHeight), messages: map[string]*hubMessage{}}
+	f.depthOnce.Do(func() {})
+	for i := range f.depth {
+		f.depth[i] = 200
+	}
+	if _, err := s.pull(pullRequest{channels: []string{channelDepth}, format: formatJSON}, f, streamStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Filter.average, before) {
+		t.Error("pull changed the temporal filter state of the stream")
+	}
+}
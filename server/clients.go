@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// kinds of clients in the registry, by endpoint
+const (
+	kindStream = "stream" // /stream/ websocket
+	kindMJPEG  = "mjpeg"
+	kindEvents = "events"
+	kindGRPC   = "grpc" // Subscribe
+	kindTIN    = "tin"  // /tin/stream/ websocket
+)
+
+// clientInfo describes a connected client for the admin listing, the fields
+// after Connected are set for stream clients only
+type clientInfo struct {
+	ID        int            `json:"id"`
+	Kind      string         `json:"kind"`
+	IP        string         `json:"ip"`
+	Connected time.Time      `json:"connected"`
+	Channels  map[string]int `json:"channels,omitempty"` // subscribed channels and their interval in ms at full rate
+	Rate      float64        `json:"rate,omitempty"`     // channel messages per second after slowdown
+	Type      string         `json:"type,omitempty"`
+	Format    string         `json:"format,omitempty"`
+	Stats     *streamStats   `json:"stats,omitempty"`
+}
+
+// registeredClient is a client of a streaming endpoint counted against the limits
+type registeredClient interface {
+	info() clientInfo
+	disconnect() // by admin
+}
+
+type registration struct {
+	ip     string
+	client registeredClient
+}
+
+// clientRegistry keeps the connected clients of all streaming endpoints and
+// enforces the limits
+type clientRegistry struct {
+	mutex   sync.Mutex
+	nextID  int
+	clients map[int]registration
+}
+
+var streamClients = &clientRegistry{clients: map[int]registration{}}
+
+// add registers a client unless the server or its IP address is full and
+// returns its id
+func (r *clientRegistry) add(ip string, c registeredClient) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if max_clients > 0 && len(r.clients) >= max_clients {
+		return 0, fmt.Errorf("server is full with %d clients", max_clients)
+	}
+	perIP := 0
+	for _, other := range r.clients {
+		if other.ip == ip {
+			perIP++
+		}
+	}
+	if max_clients_per_ip > 0 && perIP >= max_clients_per_ip {
+		return 0, fmt.Errorf("%s has %d clients already", ip, perIP)
+	}
+	r.nextID++
+	r.clients[r.nextID] = registration{ip: ip, client: c}
+	return r.nextID, nil
+}
+
+func (r *clientRegistry) remove(id int) {
+	r.mutex.Lock()
+	delete(r.clients, id)
+	r.mutex.Unlock()
+}
+
+func (r *clientRegistry) get(id int) (registeredClient, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c, ok := r.clients[id]
+	return c.client, ok
+}
+
+// list returns all clients, oldest first
+func (r *clientRegistry) list() []clientInfo {
+	r.mutex.Lock()
+	infos := make([]clientInfo, 0, len(r.clients))
+	for id, c := range r.clients {
+		info := c.client.info()
+		info.ID, info.IP = id, c.ip
+		infos = append(infos, info)
+	}
+	r.mutex.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// endpointClient is a client of an endpoint without settings of its own,
+// like an /mjpeg/ viewer. Its handler ends when done is closed.
+type endpointClient struct {
+	kind      string
+	connected time.Time
+	once      sync.Once
+	done      chan struct{}
+}
+
+func newEndpointClient(kind string) *endpointClient {
+	return &endpointClient{kind: kind, connected: time.Now(), done: make(chan struct{})}
+}
+
+func (c *endpointClient) info() clientInfo {
+	return clientInfo{Kind: c.kind, Connected: c.connected}
+}
+
+func (c *endpointClient) disconnect() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// disconnected reports whether an admin disconnected the client
+func (c *endpointClient) disconnected() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeWith sends a close frame with a reason and closes the connection,
+// reader, writer and render loop of the client end with it
+func (c *Client) closeWith(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+	c.conn.Close()
+}
+
+// setSettings publishes the settings of the render loop for the admin listing
+func (c *Client) setSettings(s streamSettings) {
+	c.mutex.Lock()
+	c.settings = s
+	c.mutex.Unlock()
+}
+
+func (c *Client) info() clientInfo {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.out.statistics()
+	rate := 0.0
+	for name, ms := range c.settings.Channels {
+		if name != channelEvents {
+			rate += 1000 / (float64(ms) * stats.Slowdown)
+		}
+	}
+	return clientInfo{
+		Kind:      kindStream,
+		Connected: c.connected,
+		Channels:  c.settings.Channels,
+		Rate:      rate,
+		Type:      c.settings.Type,
+		Format:    c.settings.Format,
+		Stats:     &stats,
+	}
+}
+
+func (c *Client) disconnect() {
+	c.closeWith(websocket.ClosePolicyViolation, "disconnected by admin")
+}
+
+// remoteIP is the address the client connected from, forwarded headers are
+// only trusted with -trust-proxy as any client can send them
+func remoteIP(c *gin.Context) string {
+	if trust_proxy {
+		return c.ClientIP()
+	}
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+	return host
+}
+
+// adminAuth requires the admin token as bearer token if one is set. Without a
+// token only requests from the server itself are allowed, none behind a proxy
+// as every request seems to come from the proxy then.
+func adminAuth(c *gin.Context) {
+	if admin_token != "" {
+		// compared in constant time so the token can't be guessed byte by byte
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+admin_token)) != 1 {
+			c.AbortWithStatusJSON(401, "admin token required")
+		}
+		return
+	}
+	if ip := net.ParseIP(remoteIP(c)); trust_proxy || ip == nil || !ip.IsLoopback() {
+		c.AbortWithStatusJSON(403, "admin endpoints are local only without -admin-token")
+	}
+}
+
+// GetClients godoc
+// @Summary Lists connected streaming clients
+// @Description Returns every client of /stream/, /mjpeg/, /events and gRPC Subscribe with its kind and address, /stream/ clients with their channels, format and stream statistics like bytes sent.
+// @Description Requires the token given with -admin-token as bearer token if set, otherwise only answers requests from localhost.
+// @Produce  json
+// @Success 200 {array} clientInfo
+// @Failure 401 {object} string
+// @Failure 403 {object} string
+// @Router /admin/clients [get]
+func GetClients(c *gin.Context) {
+	c.JSON(200, streamClients.list())
+}
+
+// DeleteClient godoc
+// @Summary Disconnects a streaming client
+// @Description Closes the websocket of a /stream/ client with a close frame or ends the stream of other clients, requires the admin token like the listing.
+// @Produce  json
+// @Param id path int true "Client id from the listing"
+// @Success 200 {object} string
+// @Failure 401 {object} string
+// @Failure 403 {object} string
+// @Failure 404 {object} string
+// @Router /admin/clients/{id} [delete]
+func DeleteClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	client, ok := streamClients.get(id)
+	if err != nil || !ok {
+		c.JSON(404, "no such client")
+		return
+	}
+	client.disconnect()
+	c.JSON(200, "OK")
+}
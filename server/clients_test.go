@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientLimits(t *testing.T) {
+	defer func(total, perIP int) { max_clients, max_clients_per_ip = total, perIP }(max_clients, max_clients_per_ip)
+	max_clients, max_clients_per_ip = 3, 2
+
+	r := &clientRegistry{clients: map[int]registration{}}
+	steps := []struct {
+		name   string
+		ip     string
+		remove int // id removed before adding, 0 for none
+		ok     bool
+	}{
+		{"first", "10.0.0.1", 0, true},
+		{"second of the address", "10.0.0.1", 0, true},
+		{"third of the address", "10.0.0.1", 0, false},
+		{"other address", "10.0.0.2", 0, true},
+		{"server full", "10.0.0.3", 0, false},
+		{"after one left", "10.0.0.3", 1, true},
+		{"address has one left", "10.0.0.1", 0, false},
+	}
+	for _, s := range steps {
+		if s.remove != 0 {
+			r.remove(s.remove)
+		}
+		_, err := r.add(s.ip, newEndpointClient(kindMJPEG))
+		if (err == nil) != s.ok {
+			t.Errorf("%s: %v", s.name, err)
+		}
+	}
+	infos := r.list()
+	if len(infos) != 3 || infos[0].ID != 2 || infos[1].ID != 3 || infos[2].ID != 4 || infos[2].IP != "10.0.0.3" || infos[2].Kind != kindMJPEG {
+		t.Errorf("listed %+v", infos)
+	}
+
+	max_clients, max_clients_per_ip = 0, 0
+	for i := 0; i < 20; i++ {
+		if _, err := r.add("10.0.0.1", newEndpointClient(kindGRPC)); err != nil {
+			t.Fatalf("without limits: %v", err)
+		}
+	}
+}
+
+// testContext returns a gin context of a request from remoteAddr
+func testContext(method, target, remoteAddr string, header map[string]string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Request.RemoteAddr = remoteAddr
+	for k, v := range header {
+		c.Request.Header.Set(k, v)
+	}
+	return c, w
+}
+
+func TestRemoteIP(t *testing.T) {
+	defer func(trust bool) { trust_proxy = trust }(trust_proxy)
+	tests := []struct {
+		trust     bool
+		forwarded string
+		want      string
+	}{
+		{false, "", "192.168.1.5"},
+		{false, "203.0.113.7", "192.168.1.5"},
+		{true, "203.0.113.7", "203.0.113.7"},
+		{true, "203.0.113.7, 192.168.1.5", "203.0.113.7"},
+		{true, "", "192.168.1.5"},
+	}
+	for _, tt := range tests {
+		trust_proxy = tt.trust
+		c, _ := testContext("GET", "/stream/100/", "192.168.1.5:50000", map[string]string{"X-Forwarded-For": tt.forwarded})
+		if got := remoteIP(c); got != tt.want {
+			t.Errorf("trust %v, forwarded for %q: %s, want %s", tt.trust, tt.forwarded, got, tt.want)
+		}
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	defer func(token string, trust bool) { admin_token, trust_proxy = token, trust }(admin_token, trust_proxy)
+	tests := []struct {
+		name   string
+		token  string
+		trust  bool
+		remote string
+		auth   string
+		want   int
+	}{
+		{"localhost without token", "", false, "127.0.0.1:5000", "", 200},
+		{"ipv6 localhost without token", "", false, "[::1]:5000", "", 200},
+		{"remote without token", "", false, "192.168.1.5:5000", "", 403},
+		{"behind a proxy without token", "", true, "127.0.0.1:5000", "", 403},
+		{"token", "secret", false, "192.168.1.5:5000", "Bearer secret", 200},
+		{"token behind a proxy", "secret", true, "127.0.0.1:5000", "Bearer secret", 200},
+		{"wrong token", "secret", false, "127.0.0.1:5000", "Bearer secreT", 401},
+		{"token prefix", "secret", false, "127.0.0.1:5000", "Bearer secre", 401},
+		{"missing token", "secret", false, "127.0.0.1:5000", "", 401},
+		{"token without bearer", "secret", false, "127.0.0.1:5000", "secret", 401},
+	}
+	for _, tt := range tests {
+		admin_token, trust_proxy = tt.token, tt.trust
+		c, w := testContext("GET", "/admin/clients", tt.remote, map[string]string{"Authorization": tt.auth})
+		adminAuth(c)
+		got := 200
+		if c.IsAborted() {
+			got = w.Code
+		}
+		if got != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/admin/clients", GetClients)
+	router.DELETE("/admin/clients/:id", DeleteClient)
+
+	client := newEndpointClient(kindEvents)
+	id, err := streamClients.add("10.0.0.9", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer streamClients.remove(id)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/clients", nil))
+	var infos []clientInfo
+	json.Unmarshal(w.Body.Bytes(), &infos)
+	found := false
+	for _, info := range infos {
+		found = found || info.ID == id && info.Kind == kindEvents && info.IP == "10.0.0.9" && info.Stats == nil
+	}
+	if w.Code != 200 || !found {
+		t.Errorf("listing %d %s", w.Code, w.Body)
+	}
+
+	for _, tt := range []struct {
+		id   string
+		want int
+	}{
+		{strconv.Itoa(id + 1000), http.StatusNotFound},
+		{"first", http.StatusNotFound},
+		{strconv.Itoa(id), http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/clients/"+tt.id, nil))
+		if w.Code != tt.want {
+			t.Errorf("deleting %s: %d, want %d", tt.id, w.Code, tt.want)
+		}
+	}
+	if !client.disconnected() {
+		t.Error("client not disconnected")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// cloudPoint is a coloured point in camera space, metres
+type cloudPoint struct {
+	X, Y, Z float32
+	R, G, B uint8
+}
+
+// pointCloud projects every step-th valid depth pixel with the camera
+// intrinsics and colours it from the registered RGB frame
+func pointCloud(depth []uint16, rgb *image.RGBA, in cameraIntrinsics, step int) []cloudPoint {
+	if step < 1 {
+		step = 1
+	}
+	var points []cloudPoint
+	for v := 0; v < in.Height; v += step {
+		for u := 0; u < in.Width; u += step {
+			i := v*in.Width + u
+			if depth[i] == 0 {
+				continue
+			}
+			z := float64(depth[i]) * in.DepthScale
+			points = append(points, cloudPoint{
+				X: float32((float64(u) - in.Cx) * z / in.Fx),
+				Y: float32((float64(v) - in.Cy) * z / in.Fy),
+				Z: float32(z),
+				R: rgb.Pix[4*i],
+				G: rgb.Pix[4*i+1],
+				B: rgb.Pix[4*i+2],
+			})
+		}
+	}
+	return points
+}
+
+// writePCD writes points in PCL's PCD v0.7 format with packed rgb
+func writePCD(w io.Writer, points []cloudPoint, binaryData bool) error {
+	data := "ascii"
+	if binaryData {
+		data = "binary"
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# .PCD v0.7 - Point Cloud Data file format\nVERSION 0.7\n")
+	fmt.Fprintf(bw, "FIELDS x y z rgb\nSIZE 4 4 4 4\nTYPE F F F U\nCOUNT 1 1 1 1\n")
+	fmt.Fprintf(bw, "WIDTH %d\nHEIGHT 1\nVIEWPOINT 0 0 0 1 0 0 0\nPOINTS %d\nDATA %s\n", len(points), len(points), data)
+	buf := make([]byte, 16)
+	for _, p := range points {
+		rgb := uint32(p.R)<<16 | uint32(p.G)<<8 | uint32(p.B)
+		if !binaryData {
+			fmt.Fprintf(bw, "%g %g %g %d\n", p.X, p.Y, p.Z, rgb)
+			continue
+		}
+		binary.LittleEndian.PutUint32(buf[0:], math.Float32bits(p.X))
+		binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(p.Y))
+		binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(p.Z))
+		binary.LittleEndian.PutUint32(buf[12:], rgb)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// lasHeader is the public header block of a LAS 1.2 file
+type lasHeader struct {
+	Signature          [4]byte
+	FileSourceID       uint16
+	GlobalEncoding     uint16
+	GUID               [16]byte
+	VersionMajor       uint8
+	VersionMinor       uint8
+	SystemIdentifier   [32]byte
+	GeneratingSoftware [32]byte
+	CreationDay        uint16
+	CreationYear       uint16
+	HeaderSize         uint16
+	PointDataOffset    uint32
+	NumberOfVLRs       uint32
+	PointFormat        uint8
+	PointRecordLength  uint16
+	NumberOfPoints     uint32
+	PointsByReturn     [5]uint32
+	Scale              [3]float64
+	Offset             [3]float64
+	MaxX, MinX         float64
+	MaxY, MinY         float64
+	MaxZ, MinZ         float64
+}
+
+// lasPoint is a point data record of format 2
+type lasPoint struct {
+	X, Y, Z        int32
+	Intensity      uint16
+	ReturnFlags    uint8
+	Classification uint8
+	ScanAngle      int8
+	UserData       uint8
+	PointSourceID  uint16
+	R, G, B        uint16
+}
+
+const lasScale = 0.001
+
+// writeLAS writes points as LAS 1.2 point format 2. The camera looks down on
+// the sand, so points are turned into a z-up system with z as height above base (m).
+func writeLAS(w io.Writer, points []cloudPoint, base float64) error {
+	h := lasHeader{
+		VersionMajor:      1,
+		VersionMinor:      2,
+		CreationDay:       uint16(time.Now().YearDay()),
+		CreationYear:      uint16(time.Now().Year()),
+		HeaderSize:        227,
+		PointDataOffset:   227,
+		PointFormat:       2,
+		PointRecordLength: 26,
+		NumberOfPoints:    uint32(len(points)),
+		Scale:             [3]float64{lasScale, lasScale, lasScale},
+	}
+	h.MinX, h.MinY, h.MinZ = math.Inf(1), math.Inf(1), math.Inf(1)
+	h.MaxX, h.MaxY, h.MaxZ = math.Inf(-1), math.Inf(-1), math.Inf(-1)
+	copy(h.Signature[:], "LASF")
+	copy(h.SystemIdentifier[:], "Kinect")
+	copy(h.GeneratingSoftware[:], "gosand")
+	h.PointsByReturn[0] = h.NumberOfPoints
+
+	records := make([]lasPoint, len(points))
+	for i, p := range points {
+		x, y, z := float64(p.X), -float64(p.Y), base-float64(p.Z)
+		h.MinX, h.MaxX = math.Min(h.MinX, x), math.Max(h.MaxX, x)
+		h.MinY, h.MaxY = math.Min(h.MinY, y), math.Max(h.MaxY, y)
+		h.MinZ, h.MaxZ = math.Min(h.MinZ, z), math.Max(h.MaxZ, z)
+		records[i] = lasPoint{
+			X:              int32(math.Round(x / lasScale)),
+			Y:              int32(math.Round(y / lasScale)),
+			Z:              int32(math.Round(z / lasScale)),
+			ReturnFlags:    1 | 1<<3, // return 1 of 1
+			Classification: 2,        // ground
+			R:              uint16(p.R) * 257,
+			G:              uint16(p.G) * 257,
+			B:              uint16(p.B) * 257,
+		}
+	}
+	if len(points) == 0 {
+		h.MinX, h.MaxX, h.MinY, h.MaxY, h.MinZ, h.MaxZ = 0, 0, 0, 0, 0, 0
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, records); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// GetCloud godoc
+// @Summary Get Point Cloud
+// @Description gets the coloured point cloud of the registered depth and RGB frames as PCD (camera space) or LAS 1.2 (z-up, height above base)
+// @Produce  octet-stream
+// @Param format path string true "pcd or las"
+// @Param data query string false "pcd only: binary (default) or ascii"
+// @Param step query int false "Pixel subsampling, default 1"
+// @Param base query number false "las only: distance camera to baseline in mm, default farthest point"
+// @Success 200 byte cloud
+// @Failure 404 {object} string
+// @Router /export/cloud.{format} [get]
+func GetCloud(c *gin.Context) {
+	ext := path.Ext(c.Request.URL.Path)
+	if ext != ".pcd" && ext != ".las" {
+		c.Data(404, "", nil)
+		return
+	}
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+
+	depth := freenect_device.DepthArray16(false)
+	rgb := freenect_device.RGBAFrame()
+	points := pointCloud(depth, rgb, kinectIntrinsics, queryInt(c, "step", 1))
+
+	c.Writer.Header().Set("Content-Type", "application/octet-stream")
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand-cloud"+ext)
+	var err error
+	if ext == ".pcd" {
+		err = writePCD(c.Writer, points, c.Request.URL.Query().Get("data") != "ascii")
+	} else {
+		base := queryFloat(c, "base", 0)
+		if base <= 0 {
+			for _, d := range depth {
+				base = math.Max(base, float64(d))
+			}
+		}
+		err = writeLAS(c.Writer, points, base*kinectIntrinsics.DepthScale)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
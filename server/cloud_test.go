@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPointCloud(t *testing.T) {
+	depth := make([]uint16, frameWidth*frameHeight)
+	rgb := image.NewRGBA(image.Rect(0, 0, frameWidth, frameHeight))
+	center := 240*frameWidth + 320
+	depth[center], depth[0] = 1000, 2000
+	copy(rgb.Pix[4*center:], []byte{10, 20, 30, 255})
+	points := pointCloud(depth, rgb, kinectIntrinsics, 1)
+	if len(points) != 2 {
+		t.Fatalf("%d points, want 2", len(points))
+	}
+	corner, middle := points[0], points[1]
+	if middle.Z != 1 || math.Abs(float64(middle.X)-0.5/525) > 1e-6 || middle.R != 10 || middle.B != 30 {
+		t.Errorf("center pixel %+v", middle)
+	}
+	if corner.Z != 2 || math.Abs(float64(corner.X)+2*319.5/525) > 1e-6 || math.Abs(float64(corner.Y)+2*239.5/525) > 1e-6 {
+		t.Errorf("corner pixel %+v", corner)
+	}
+	if n := len(pointCloud(depth, rgb, kinectIntrinsics, 3)); n != 1 {
+		t.Errorf("%d points with step 3, want the corner only", n)
+	}
+}
+
+func TestPCD(t *testing.T) {
+	points := []cloudPoint{{1, 2, 3, 255, 0, 1}, {-0.5, 0.25, 1.5, 0, 128, 0}}
+	for _, binaryData := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := writePCD(&buf, points, binaryData); err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(&buf)
+		header := map[string]string{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+			header[fields[0]] = fields[1]
+			if fields[0] == "DATA" {
+				break
+			}
+		}
+		if header["POINTS"] != "2" || header["WIDTH"] != "2" || header["FIELDS"] != "x y z rgb" {
+			t.Errorf("binary %v: header %v", binaryData, header)
+		}
+		rest, _ := r.Peek(r.Buffered())
+		if !binaryData {
+			if want := "1 2 3 16711681\n-0.5 0.25 1.5 32768\n"; string(rest) != want {
+				t.Errorf("ascii data %q, want %q", rest, want)
+			}
+			continue
+		}
+		if header["DATA"] != "binary" || len(rest) != 32 {
+			t.Fatalf("%s data of %d bytes", header["DATA"], len(rest))
+		}
+		if x := math.Float32frombits(binary.LittleEndian.Uint32(rest[16:])); x != -0.5 {
+			t.Errorf("second x %v", x)
+		}
+		if rgb := binary.LittleEndian.Uint32(rest[12:]); rgb != 0xff0001 {
+			t.Errorf("first rgb %x", rgb)
+		}
+	}
+}
+
+func TestLAS(t *testing.T) {
+	tests := []struct {
+		points []cloudPoint
+		min    [3]float64
+		max    [3]float64
+	}{
+		{nil, [3]float64{}, [3]float64{}},
+		{[]cloudPoint{{0.1, 0.2, 0.9, 255, 0, 0}, {-0.1, -0.2, 1.0, 0, 0, 255}}, [3]float64{-0.1, -0.2, 0}, [3]float64{0.1, 0.2, 0.1}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeLAS(&buf, tt.points, 1); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if size := binary.Size(lasHeader{}); size != 227 {
+			t.Fatalf("LAS 1.2 header has %d bytes, want 227", size)
+		}
+		if size := binary.Size(lasPoint{}); size != 26 {
+			t.Fatalf("point format 2 record has %d bytes, want 26", size)
+		}
+		if len(b) != 227+26*len(tt.points) {
+			t.Errorf("%d points in %d bytes", len(tt.points), len(b))
+		}
+		var h lasHeader
+		binary.Read(bytes.NewReader(b), binary.LittleEndian, &h)
+		if string(h.Signature[:]) != "LASF" || h.HeaderSize != 227 || h.PointDataOffset != 227 || h.NumberOfPoints != uint32(len(tt.points)) {
+			t.Errorf("header %+v", h)
+		}
+		got := [6]float64{h.MinX, h.MinY, h.MinZ, h.MaxX, h.MaxY, h.MaxZ}
+		want := [6]float64{tt.min[0], tt.min[1], tt.min[2], tt.max[0], tt.max[1], tt.max[2]}
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 1e-6 {
+				t.Errorf("bounds %v, want %v", got, want)
+				break
+			}
+		}
+		if len(tt.points) == 0 {
+			continue
+		}
+		var p lasPoint
+		binary.Read(bytes.NewReader(b[227:]), binary.LittleEndian, &p)
+		if p.X != 100 || p.Y != -200 || p.Z != 100 || p.R != 65535 || p.B != 0 {
+			t.Errorf("first point %+v", p)
+		}
+	}
+}
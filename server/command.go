@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// frame types a stream can send in d
+var streamTypes = map[string]string{
+	"deptharray": "", // raw 8-bit depth array
+	"depthframe": "depth",
+	"irframe":    "ir",
+	"rgbframe":   "rgb",
+}
+
+// channels a stream client can subscribe to, each sent with its own interval
+// and tagged with its name in ch
+const (
+	channelFrame    = "frame"    // payload as configured by type, detection and terrain options
+	channelDepth    = "depth"    // depth array in d
+	channelRGB      = "rgb"      // RGB JPEG in d
+	channelIR       = "ir"       // IR JPEG in d
+	channelCircles  = "circles"  // detected circles in c
+	channelContours = "contours" // contour lines in l
+	channelEvents   = "events"   // server events as they happen, no interval
+	channelStats    = "stats"    // sent, dropped frames, latency and slowdown of this client
+)
+
+var streamChannels = []string{channelFrame, channelDepth, channelRGB, channelIR, channelCircles, channelContours, channelEvents, channelStats}
+
+// depthFilter is applied to depth arrays of a stream
+type depthFilter struct {
+	Fill     bool    `json:"fill"`     // replace invalid pixels with the previous valid value
+	Median   bool    `json:"median"`   // 3x3 median against speckle noise
+	Temporal float64 `json:"temporal"` // exponential smoothing over frames, 0 (off) to 0.95
+
+	average []float64
+}
+
+// apply returns a filtered copy of a depth array, the temporal filter keeps its state between calls
+func (f *depthFilter) apply(src []byte) []byte {
+	depth := f.filled(src)
+	if f.Median {
+		depth = median3(depth, frameWidth, frameHeight)
+	}
+	if f.Temporal <= 0 {
+		f.average = nil
+		return depth
+	}
+	if len(f.average) != len(depth) {
+		f.average = make([]float64, len(depth))
+		for i, d := range depth {
+			f.average[i] = float64(d)
+		}
+	}
+	for i, d := range depth {
+		f.average[i] = f.Temporal*f.average[i] + (1-f.Temporal)*float64(d)
+		depth[i] = byte(f.average[i] + 0.5)
+	}
+	return depth
+}
+
+// filled returns a copy of a depth array, invalid pixels are replaced by the
+// previous valid value if Fill is set
+func (f depthFilter) filled(src []byte) []byte {
+	depth := make([]byte, len(src))
+	copy(depth, src)
+	if f.Fill {
+		before := byte(0)
+		for i, d := range depth {
+			if d == 0 {
+				depth[i] = before
+			}
+			before = depth[i]
+		}
+	}
+	return depth
+}
+
+// median3 returns the 3x3 median of every pixel, borders are copied
+func median3(src []byte, width, height int) []byte {
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	var w [9]byte
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			k := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					w[k] = src[(y+dy)*width+x+dx]
+					k++
+				}
+			}
+			for i := 1; i < 9; i++ {
+				for j := i; j > 0 && w[j] < w[j-1]; j-- {
+					w[j], w[j-1] = w[j-1], w[j]
+				}
+			}
+			dst[y*width+x] = w[4]
+		}
+	}
+	return dst
+}
+
+// streamSettings control what a websocket stream sends, they can be changed
+// by the client with commands while streaming
+type streamSettings struct {
+	Channels  map[string]int `json:"channels"` // subscribed channels and their interval in ms
+	Type      string         `json:"type"`
+	Detection bool           `json:"detection"`
+	ROI       []int          `json:"roi"` // x, y, width, height, null for the full frame
+	Filter    depthFilter    `json:"filter"`
+	Format    string         `json:"format"`
+	Change    changeMode     `json:"change"`
+	Terrain   terrainOptions `json:"-"`
+}
+
+// cacheKey identifies the message of a channel shared by all clients with the
+// same settings, "" if it depends on the client's own state
+func (s *streamSettings) cacheKey(name string) string {
+	if name == channelStats || s.Filter.Temporal > 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %s %v %v %v %v %+v", name, s.Format, s.Type, s.Detection, s.ROI, s.Filter.Fill, s.Filter.Median, s.Terrain)
+}
+
+// filterVersion identifies the filter and roi settings, it changes whenever they do
+func (s *streamSettings) filterVersion() uint32 {
+	return crc32.ChecksumIEEE([]byte(fmt.Sprintf("%v %v %v %v", s.Filter.Fill, s.Filter.Median, s.Filter.Temporal, s.ROI)))
+}
+
+// validInterval checks a channel interval in ms against -min-interval
+func validInterval(ms int) error {
+	if ms < min_interval {
+		return fmt.Errorf("interval must be at least %d ms", min_interval)
+	}
+	return nil
+}
+
+// subscribe adds a channel or changes its interval
+func (s *streamSettings) subscribe(channel string, ms int) error {
+	known := false
+	for _, name := range streamChannels {
+		known = known || name == channel
+	}
+	if !known {
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+	if channel == channelEvents {
+		ms = 0
+	} else if err := validInterval(ms); err != nil {
+		return err
+	}
+	channels := map[string]int{channel: ms}
+	for name, interval := range s.Channels {
+		if name != channel {
+			channels[name] = interval
+		}
+	}
+	s.Channels = channels
+	return nil
+}
+
+// shortestInterval returns the interval of the fastest timed channel
+func (s *streamSettings) shortestInterval() time.Duration {
+	var min time.Duration
+	for name, ms := range s.Channels {
+		d := time.Duration(ms) * time.Millisecond
+		if name != channelEvents && (min == 0 || d < min) {
+			min = d
+		}
+	}
+	return min
+}
+
+func (s *streamSettings) unsubscribe(channel string) {
+	channels := map[string]int{}
+	for name, interval := range s.Channels {
+		if name != channel {
+			channels[name] = interval
+		}
+	}
+	s.Channels = channels
+}
+
+// command is a JSON message sent by a stream client, e.g.
+// {"cmd":"set","id":1,"interval":100,"type":"rgbframe","roi":[0,0,320,240]}
+// or {"cmd":"subscribe","channel":"rgb","interval":500}.
+// Fields left out of a set command keep their value.
+type command struct {
+	Cmd       string          `json:"cmd"`
+	ID        json.RawMessage `json:"id,omitempty"` // echoed in the reply
+	Channel   string          `json:"channel"`
+	Interval  *int            `json:"interval"` // of the frame channel for set
+	Type      *string         `json:"type"`
+	Detection *bool           `json:"detection"`
+	ROI       []int           `json:"roi"`    // [] resets to the full frame
+	Filter    json.RawMessage `json:"filter"` // fields left out keep their value too
+	Format    *string         `json:"format"`
+	Change    json.RawMessage `json:"change"`   // fields left out keep their value too
+	Channels  []string        `json:"channels"` // of a next command, frame if empty
+}
+
+// reply acknowledges a command or reports why it failed
+type reply struct {
+	Reply    string          `json:"reply"`
+	ID       json.RawMessage `json:"id,omitempty"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Settings *streamSettings `json:"settings,omitempty"`
+	Stats    *streamStats    `json:"stats,omitempty"`
+
+	pull *pullRequest // of a next command
+}
+
+// maxPendingPulls limits the next commands of a client waiting for a frame
+// or for the writer, pulled messages are never dropped
+const maxPendingPulls = 4
+
+// pullRequest is a next command waiting for a frame taken after it
+type pullRequest struct {
+	id       json.RawMessage // of the command, echoed if the pull fails
+	channels []string
+	format   string
+	after    time.Time
+}
+
+// failed returns the error reply of a pull that couldn't be built, the
+// client got ok for the command already
+func (p pullRequest) failed(err error) message {
+	b, _ := json.Marshal(reply{Reply: "next", ID: p.id, Error: err.Error()})
+	return message{kind: websocket.TextMessage, data: b}
+}
+
+// next validates a next command, channels and format default to the frame
+// channel and the stream's format
+func (s *streamSettings) next(cmd command) (pullRequest, error) {
+	p := pullRequest{id: cmd.ID, channels: cmd.Channels, format: s.Format, after: time.Now()}
+	if len(p.channels) == 0 {
+		p.channels = []string{channelFrame}
+	}
+	for _, channel := range p.channels {
+		known := false
+		for _, name := range streamChannels {
+			known = known || name == channel
+		}
+		if !known || channel == channelEvents {
+			return p, fmt.Errorf("can't pull channel %q", channel)
+		}
+	}
+	if cmd.Format != nil {
+		if _, ok := formatMIMETypes[*cmd.Format]; !ok {
+			return p, fmt.Errorf("unknown format %q", *cmd.Format)
+		}
+		p.format = *cmd.Format
+	}
+	if p.format == formatRaw && (s.Detection || s.Terrain.enabled()) {
+		return p, errRawTerrain
+	}
+	return p, nil
+}
+
+// apply validates a set command and changes the settings only if all fields are valid
+func (s *streamSettings) apply(cmd command) error {
+	next := *s
+	if cmd.Interval != nil {
+		if err := next.subscribe(channelFrame, *cmd.Interval); err != nil {
+			return err
+		}
+	}
+	if cmd.Type != nil {
+		if _, ok := streamTypes[*cmd.Type]; !ok {
+			return fmt.Errorf("unknown type %q", *cmd.Type)
+		}
+		next.Type = *cmd.Type
+	}
+	if cmd.Detection != nil {
+		next.Detection = *cmd.Detection
+	}
+	if cmd.ROI != nil {
+		if len(cmd.ROI) == 0 {
+			next.ROI = nil
+		} else if len(cmd.ROI) != 4 || cmd.ROI[0] < 0 || cmd.ROI[1] < 0 || cmd.ROI[2] < 1 || cmd.ROI[3] < 1 ||
+			cmd.ROI[0]+cmd.ROI[2] > frameWidth || cmd.ROI[1]+cmd.ROI[3] > frameHeight {
+			return errors.New("roi must be [x, y, width, height] inside the 640x480 frame")
+		} else {
+			next.ROI = cmd.ROI
+		}
+	}
+	if cmd.Filter != nil {
+		f := depthFilter{Fill: s.Filter.Fill, Median: s.Filter.Median, Temporal: s.Filter.Temporal}
+		if err := json.Unmarshal(cmd.Filter, &f); err != nil {
+			return errors.New("invalid filter: " + err.Error())
+		}
+		if f.Temporal < 0 || f.Temporal > 0.95 {
+			return errors.New("temporal filter must be between 0 and 0.95")
+		}
+		next.Filter = f
+	}
+	if cmd.Change != nil {
+		m := s.Change
+		if err := json.Unmarshal(cmd.Change, &m); err != nil {
+			return errors.New("invalid change: " + err.Error())
+		}
+		if m.Height < 0 || m.Pixel < 0 || m.Pixels < 0 || m.Circles < 0 {
+			return errors.New("change thresholds must not be negative")
+		}
+		if m.Heartbeat != 0 {
+			if err := validInterval(m.Heartbeat); err != nil {
+				return errors.New("heartbeat " + err.Error())
+			}
+		}
+		next.Change = m
+	}
+	if cmd.Format != nil {
+		if _, ok := formatMIMETypes[*cmd.Format]; !ok {
+			return fmt.Errorf("unknown format %q", *cmd.Format)
+		}
+		next.Format = *cmd.Format
+	}
+	if next.Format == formatRaw && (next.Detection || next.Terrain.enabled()) {
+		return errRawTerrain
+	}
+	*s = next
+	return nil
+}
+
+// handle runs a command message and returns the reply
+func (s *streamSettings) handle(message []byte) reply {
+	var cmd command
+	if err := json.Unmarshal(message, &cmd); err != nil {
+		return reply{Error: "invalid command: " + err.Error()}
+	}
+	r := reply{Reply: cmd.Cmd, ID: cmd.ID}
+	switch cmd.Cmd {
+	case "set":
+		if err := s.apply(cmd); err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	case "subscribe":
+		interval := 0
+		if cmd.Interval != nil {
+			interval = *cmd.Interval
+		} else if cmd.Channel != channelEvents {
+			interval = 200
+		}
+		if err := s.subscribe(cmd.Channel, interval); err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	case "unsubscribe":
+		s.unsubscribe(cmd.Channel)
+	case "next":
+		p, err := s.next(cmd)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		r.pull = &p
+	case "get", "stats":
+	default:
+		r.Error = fmt.Sprintf("unknown command %q", cmd.Cmd)
+		return r
+	}
+	r.OK = true
+	settings := *s
+	r.Settings = &settings
+	return r
+}
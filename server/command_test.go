@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testSettings() streamSettings {
+	return streamSettings{Channels: map[string]int{channelFrame: 100}, Type: "deptharray", Format: formatJSON}
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		reply   string // reply, ok and id as JSON
+		err     string // part of the error
+		changed func(s *streamSettings)
+	}{
+		{"invalid json", `{"cmd":`, `{"reply":"","ok":false}`, "invalid command", nil},
+		{"wrong field type", `{"cmd":"set","interval":"fast"}`, `{"reply":"","ok":false}`, "invalid command", nil},
+		{"unknown command", `{"cmd":"jump","id":3}`, `{"reply":"jump","id":3,"ok":false}`, `unknown command "jump"`, nil},
+		{"get", `{"cmd":"get","id":"a"}`, `{"reply":"get","id":"a","ok":true}`, "", nil},
+		{"set interval and type", `{"cmd":"set","id":1,"interval":200,"type":"rgbframe"}`, `{"reply":"set","id":1,"ok":true}`, "",
+			func(s *streamSettings) { s.Channels = map[string]int{channelFrame: 200}; s.Type = "rgbframe" }},
+		{"set interval below min_interval", `{"cmd":"set","interval":1}`, `{"reply":"set","ok":false}`, "interval must be at least", nil},
+		{"set unknown type", `{"cmd":"set","type":"colour"}`, `{"reply":"set","ok":false}`, `unknown type "colour"`, nil},
+		{"set roi", `{"cmd":"set","roi":[10,20,100,50]}`, `{"reply":"set","ok":true}`, "",
+			func(s *streamSettings) { s.ROI = []int{10, 20, 100, 50} }},
+		{"set roi outside the frame", `{"cmd":"set","roi":[600,0,100,50]}`, `{"reply":"set","ok":false}`, "roi must be", nil},
+		{"set roi of three values", `{"cmd":"set","roi":[0,0,100]}`, `{"reply":"set","ok":false}`, "roi must be", nil},
+		{"set filter", `{"cmd":"set","filter":{"median":true,"temporal":0.5}}`, `{"reply":"set","ok":true}`, "",
+			func(s *streamSettings) { s.Filter = depthFilter{Median: true, Temporal: 0.5} }},
+		{"set temporal filter out of range", `{"cmd":"set","filter":{"temporal":1}}`, `{"reply":"set","ok":false}`, "temporal filter", nil},
+		{"set invalid filter", `{"cmd":"set","filter":[]}`, `{"reply":"set","ok":false}`, "invalid filter", nil},
+		{"set change", `{"cmd":"set","change":{"on":true,"height":2}}`, `{"reply":"set","ok":true}`, "",
+			func(s *streamSettings) { s.Change.On = true; s.Change.Height = 2 }},
+		{"set negative change threshold", `{"cmd":"set","change":{"pixel":-1}}`, `{"reply":"set","ok":false}`, "must not be negative", nil},
+		{"set short heartbeat", `{"cmd":"set","change":{"heartbeat":1}}`, `{"reply":"set","ok":false}`, "heartbeat interval", nil},
+		{"set unknown format", `{"cmd":"set","format":"xml"}`, `{"reply":"set","ok":false}`, `unknown format "xml"`, nil},
+		{"set raw with detection", `{"cmd":"set","format":"raw","detection":true}`, `{"reply":"set","ok":false}`, "raw format", nil},
+		{"set stops at the first invalid field", `{"cmd":"set","type":"irframe","roi":[0,0,0,0]}`, `{"reply":"set","ok":false}`, "roi must be", nil},
+		{"subscribe", `{"cmd":"subscribe","channel":"rgb","interval":500}`, `{"reply":"subscribe","ok":true}`, "",
+			func(s *streamSettings) { s.Channels = map[string]int{channelFrame: 100, channelRGB: 500} }},
+		{"subscribe with default interval", `{"cmd":"subscribe","channel":"circles"}`, `{"reply":"subscribe","ok":true}`, "",
+			func(s *streamSettings) { s.Channels = map[string]int{channelFrame: 100, channelCircles: 200} }},
+		{"subscribe events", `{"cmd":"subscribe","channel":"events","interval":500}`, `{"reply":"subscribe","ok":true}`, "",
+			func(s *streamSettings) { s.Channels = map[string]int{channelFrame: 100, channelEvents: 0} }},
+		{"subscribe unknown channel", `{"cmd":"subscribe","channel":"audio"}`, `{"reply":"subscribe","ok":false}`, `unknown channel "audio"`, nil},
+		{"unsubscribe", `{"cmd":"unsubscribe","channel":"frame"}`, `{"reply":"unsubscribe","ok":true}`, "",
+			func(s *streamSettings) { s.Channels = map[string]int{} }},
+		{"next", `{"cmd":"next","id":9}`, `{"reply":"next","id":9,"ok":true}`, "", nil},
+		{"next of events", `{"cmd":"next","channels":["events"]}`, `{"reply":"next","ok":false}`, `can't pull channel "events"`, nil},
+	}
+	for _, tt := range tests {
+		s := testSettings()
+		r := s.handle([]byte(tt.cmd))
+
+		got, _ := json.Marshal(struct {
+			Reply string          `json:"reply"`
+			ID    json.RawMessage `json:"id,omitempty"`
+			OK    bool            `json:"ok"`
+		}{r.Reply, r.ID, r.OK})
+		if string(got) != tt.reply {
+			t.Errorf("%s: replied %s, want %s", tt.name, got, tt.reply)
+		}
+		if tt.err == "" && r.Error != "" || !strings.Contains(r.Error, tt.err) {
+			t.Errorf("%s: error %q, want %q", tt.name, r.Error, tt.err)
+		}
+		if r.OK != (r.Settings != nil) {
+			t.Errorf("%s: ok %v with settings %v", tt.name, r.OK, r.Settings)
+		}
+
+		// failed commands change nothing
+		want := testSettings()
+		if tt.changed != nil {
+			tt.changed(&want)
+		}
+		if !reflect.DeepEqual(s, want) {
+			t.Errorf("%s: settings %+v, want %+v", tt.name, s, want)
+		}
+		if r.Settings != nil && !reflect.DeepEqual(*r.Settings, s) {
+			t.Errorf("%s: replied settings %+v, have %+v", tt.name, *r.Settings, s)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        streamSettings
+		cmd      string
+		channels []string
+		format   string
+		err      bool
+	}{
+		{"frame by default", testSettings(), `{"cmd":"next"}`, []string{channelFrame}, formatJSON, false},
+		{"channels and format", testSettings(), `{"cmd":"next","channels":["rgb","stats"],"format":"cbor"}`, []string{channelRGB, channelStats}, formatCBOR, false},
+		{"unknown channel", testSettings(), `{"cmd":"next","channels":["frame","audio"]}`, nil, "", true},
+		{"unknown format", testSettings(), `{"cmd":"next","format":"xml"}`, nil, "", true},
+		{"raw with detection", streamSettings{Detection: true, Format: formatJSON}, `{"cmd":"next","format":"raw"}`, nil, "", true},
+	}
+	for _, tt := range tests {
+		var cmd command
+		if err := json.Unmarshal([]byte(tt.cmd), &cmd); err != nil {
+			t.Fatal(err)
+		}
+		p, err := tt.s.next(cmd)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+		if !tt.err && (!reflect.DeepEqual(p.channels, tt.channels) || p.format != tt.format || p.after.IsZero()) {
+			t.Errorf("%s: pulls %v as %s after %v", tt.name, p.channels, p.format, p.after)
+		}
+	}
+}
+
+func TestSubscribeCopiesChannels(t *testing.T) {
+	s := testSettings()
+	published := s.Channels
+	if err := s.subscribe(channelRGB, 500); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.subscribe(channelFrame, 50); err != nil {
+		t.Fatal(err)
+	}
+	s.unsubscribe(channelFrame)
+	// a map handed out before is never written to
+	if !reflect.DeepEqual(published, map[string]int{channelFrame: 100}) {
+		t.Errorf("published channels changed to %v", published)
+	}
+	if !reflect.DeepEqual(s.Channels, map[string]int{channelRGB: 500}) {
+		t.Errorf("channels %v", s.Channels)
+	}
+	if err := s.subscribe("audio", 100); err == nil || !reflect.DeepEqual(s.Channels, map[string]int{channelRGB: 500}) {
+		t.Errorf("unknown channel: %v, channels %v", err, s.Channels)
+	}
+}
+
+func TestSettingsInfo(t *testing.T) {
+	// the render loop changes its settings while the admin listing reads them,
+	// run with -race
+	c := &Client{out: newOutbox()}
+	s := testSettings()
+	c.setSettings(s)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			s.subscribe(channelRGB, 100+i)
+			c.setSettings(s)
+			s.unsubscribe(channelRGB)
+			c.setSettings(s)
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		info := c.info()
+		if info.Channels[channelFrame] != 100 {
+			t.Fatalf("frame channel missing in %v", info.Channels)
+		}
+		if ms, ok := info.Channels[channelRGB]; ok && (ms < 100 || ms >= 1100 || len(info.Channels) != 2) {
+			t.Fatalf("inconsistent channels %v", info.Channels)
+		}
+		want := 10.0
+		if ms, ok := info.Channels[channelRGB]; ok {
+			want += 1000 / float64(ms)
+		}
+		if info.Rate != want {
+			t.Fatalf("rate %v of channels %v", info.Rate, info.Channels)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// contourLine is an iso-line of the heightfield in pixel coordinates
+type contourLine struct {
+	Level  float64      `json:"level"`
+	Points [][2]float64 `json:"points"`
+	Closed bool         `json:"closed"`
+}
+
+// contourSegment connects two crossed cell edges
+type contourSegment struct {
+	a, b int
+}
+
+const (
+	minContourInterval = 1   // mm, every level is a pass over the whole frame
+	maxContourLevels   = 256 // finer intervals are coarsened to a multiple of the interval
+)
+
+// validContourInterval checks a contour interval in mm, 0 turns contours off
+func validContourInterval(interval float64) error {
+	if interval != 0 && !(interval >= minContourInterval) {
+		return fmt.Errorf("contour interval must be at least %d mm", minContourInterval)
+	}
+	return nil
+}
+
+// contours runs marching squares over the heightfield and returns iso-lines
+// every interval starting at start. Cells touching invalid pixels are skipped.
+// Intervals giving more than maxContourLevels levels are multiplied until they fit.
+func contours(h heightfield, interval, start float64) []contourLine {
+	if !(interval > 0) {
+		return nil
+	}
+	min, max := h.Range()
+	if levels := (max - min) / interval; levels > maxContourLevels {
+		interval *= math.Ceil(levels / maxContourLevels)
+	}
+	first := start + math.Ceil((min-start)/interval)*interval
+	var lines []contourLine
+	for level := first; level <= max; level += interval {
+		lines = append(lines, contourLevel(h, level)...)
+	}
+	return lines
+}
+
+// edge ids: 2*(y*w+x) is the horizontal edge right of (x,y),
+// 2*(y*w+x)+1 the vertical edge below (x,y)
+func (h heightfield) edgeID(x, y int, vertical bool) int {
+	id := 2 * (y*h.Width + x)
+	if vertical {
+		id++
+	}
+	return id
+}
+
+// edgePoint interpolates the crossing of level on an edge
+func (h heightfield) edgePoint(id int, level float64) [2]float64 {
+	i := id / 2
+	x, y := i%h.Width, i/h.Width
+	x2, y2 := x+1, y
+	if id%2 == 1 {
+		x2, y2 = x, y+1
+	}
+	z1, z2 := h.At(x, y), h.At(x2, y2)
+	t := 0.5
+	if z1 != z2 {
+		t = (level - z1) / (z2 - z1)
+	}
+	return [2]float64{float64(x) + t*float64(x2-x), float64(y) + t*float64(y2-y)}
+}
+
+func contourLevel(h heightfield, level float64) []contourLine {
+	var segments []contourSegment
+	for y := 0; y < h.Height-1; y++ {
+		for x := 0; x < h.Width-1; x++ {
+			if !h.Valid(x, y) || !h.Valid(x+1, y) || !h.Valid(x, y+1) || !h.Valid(x+1, y+1) {
+				continue
+			}
+			// corners clockwise from top left
+			z := [4]float64{h.At(x, y), h.At(x+1, y), h.At(x+1, y+1), h.At(x, y+1)}
+			c := 0
+			for i, v := range z {
+				if v >= level {
+					c |= 1 << uint(i)
+				}
+			}
+			top, right := h.edgeID(x, y, false), h.edgeID(x+1, y, true)
+			bottom, left := h.edgeID(x, y+1, false), h.edgeID(x, y, true)
+			switch c {
+			case 1, 14:
+				segments = append(segments, contourSegment{left, top})
+			case 2, 13:
+				segments = append(segments, contourSegment{top, right})
+			case 3, 12:
+				segments = append(segments, contourSegment{left, right})
+			case 4, 11:
+				segments = append(segments, contourSegment{right, bottom})
+			case 6, 9:
+				segments = append(segments, contourSegment{top, bottom})
+			case 7, 8:
+				segments = append(segments, contourSegment{left, bottom})
+			case 5, 10:
+				// saddle, decided by the cell center
+				center := (z[0] + z[1] + z[2] + z[3]) / 4
+				if (center >= level) == (c == 5) {
+					segments = append(segments, contourSegment{left, bottom}, contourSegment{top, right})
+				} else {
+					segments = append(segments, contourSegment{left, top}, contourSegment{right, bottom})
+				}
+			}
+		}
+	}
+	return chainSegments(h, segments, level)
+}
+
+// chainSegments joins segments sharing an edge into polylines
+func chainSegments(h heightfield, segments []contourSegment, level float64) []contourLine {
+	byEdge := map[int][]int{}
+	for i, s := range segments {
+		byEdge[s.a] = append(byEdge[s.a], i)
+		byEdge[s.b] = append(byEdge[s.b], i)
+	}
+	used := make([]bool, len(segments))
+	next := func(edge int) (int, bool) {
+		for _, i := range byEdge[edge] {
+			if !used[i] {
+				used[i] = true
+				s := segments[i]
+				if s.a == edge {
+					return s.b, true
+				}
+				return s.a, true
+			}
+		}
+		return 0, false
+	}
+
+	var lines []contourLine
+	for i, s := range segments {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		edges := []int{s.a, s.b}
+		for e, ok := next(s.b); ok; e, ok = next(e) {
+			edges = append(edges, e)
+		}
+		closed := edges[0] == edges[len(edges)-1]
+		if !closed {
+			var head []int
+			for e, ok := next(s.a); ok; e, ok = next(e) {
+				head = append([]int{e}, head...)
+			}
+			edges = append(head, edges...)
+		}
+		line := contourLine{Level: level, Closed: closed}
+		for _, e := range edges {
+			line.Points = append(line.Points, h.edgePoint(e, level))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// contourOptions select contour lines drawn or sent along with depth data
+type contourOptions struct {
+	Interval float64 // contour interval in mm, 0 disables contours
+	Start    float64 // base contour level in mm
+}
+
+func contourOptionsFromQuery(c *gin.Context) (contourOptions, error) {
+	o := contourOptions{
+		Interval: queryFloat(c, "contours", 0),
+		Start:    queryFloat(c, "start", 0),
+	}
+	return o, validContourInterval(o.Interval)
+}
+
+// mapPoint converts pixel coordinates into the fake map coordinates of the DEM export
+func (opt demOptions) mapPoint(p [2]float64) [2]float64 {
+	return [2]float64{opt.OriginX + p[0]*opt.CellSize, opt.OriginY - p[1]*opt.CellSize}
+}
+
+func writeContoursGeoJSON(w io.Writer, lines []contourLine, opt demOptions) error {
+	type geometry struct {
+		Type        string       `json:"type"`
+		Coordinates [][2]float64 `json:"coordinates"`
+	}
+	type feature struct {
+		Type       string             `json:"type"`
+		Geometry   geometry           `json:"geometry"`
+		Properties map[string]float64 `json:"properties"`
+	}
+	collection := struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{Type: "FeatureCollection", Features: []feature{}}
+	for _, l := range lines {
+		g := geometry{Type: "LineString"}
+		for _, p := range l.Points {
+			g.Coordinates = append(g.Coordinates, opt.mapPoint(p))
+		}
+		collection.Features = append(collection.Features, feature{
+			Type:       "Feature",
+			Geometry:   g,
+			Properties: map[string]float64{"level": l.Level},
+		})
+	}
+	return json.NewEncoder(w).Encode(collection)
+}
+
+func writeContoursSVG(w io.Writer, lines []contourLine, width, height int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`+"\n", width, height, width, height)
+	for _, l := range lines {
+		tag := "polyline"
+		if l.Closed {
+			tag = "polygon"
+		}
+		fmt.Fprintf(bw, `<%s data-level="%g" fill="none" stroke="black" stroke-width="0.5" points="`, tag, l.Level)
+		for i, p := range l.Points {
+			if i > 0 {
+				bw.WriteByte(' ')
+			}
+			fmt.Fprintf(bw, "%.2f,%.2f", p[0], p[1])
+		}
+		bw.WriteString("\"/>\n")
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writeContoursDXF writes lines as R12 3D polylines on layer CONTOURS
+func writeContoursDXF(w io.Writer, lines []contourLine, opt demOptions) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("0\nSECTION\n2\nENTITIES\n")
+	for _, l := range lines {
+		flags := 8 // 3D polyline
+		if l.Closed {
+			flags |= 1
+		}
+		fmt.Fprintf(bw, "0\nPOLYLINE\n8\nCONTOURS\n66\n1\n10\n0.0\n20\n0.0\n30\n0.0\n70\n%d\n", flags)
+		for _, p := range l.Points {
+			m := opt.mapPoint(p)
+			fmt.Fprintf(bw, "0\nVERTEX\n8\nCONTOURS\n10\n%g\n20\n%g\n30\n%g\n70\n32\n", m[0], m[1], l.Level)
+		}
+		bw.WriteString("0\nSEQEND\n8\nCONTOURS\n")
+	}
+	bw.WriteString("0\nENDSEC\n0\nEOF\n")
+	return bw.Flush()
+}
+
+// GetContours godoc
+// @Summary Get Contour Lines
+// @Description gets contour lines of the current frame as GeoJSON, SVG or DXF
+// @Produce  json
+// @Param format path string true "geojson, svg or dxf"
+// @Param interval query number false "Contour interval in mm, default 10, at least 1"
+// @Param start query number false "Base contour level in mm, default 0"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Success 200 byte contours
+// @Failure 400 {object} string
+// @Failure 404 {object} string
+// @Router /export/contours.{format} [get]
+func GetContours(c *gin.Context) {
+	opt, err := demOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	ext := path.Ext(c.Request.URL.Path)
+	switch ext {
+	case ".geojson":
+		c.Writer.Header().Set("Content-Type", "application/geo+json")
+	case ".svg":
+		c.Writer.Header().Set("Content-Type", "image/svg+xml")
+	case ".dxf":
+		c.Writer.Header().Set("Content-Type", "image/vnd.dxf")
+	default:
+		c.Data(404, "", nil)
+		return
+	}
+	interval := queryFloat(c, "interval", 10)
+	if err := validContourInterval(interval); err != nil || interval == 0 {
+		c.JSON(400, fmt.Sprintf("contour interval must be at least %d mm", minContourInterval))
+		return
+	}
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+
+	h := captureHeightfield(c)
+	lines := contours(h, interval, queryFloat(c, "start", 0))
+
+	switch ext {
+	case ".geojson":
+		err = writeContoursGeoJSON(c.Writer, lines, opt)
+	case ".svg":
+		err = writeContoursSVG(c.Writer, lines, h.Width, h.Height)
+	case ".dxf":
+		c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand-contours.dxf")
+		err = writeContoursDXF(c.Writer, lines, opt)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
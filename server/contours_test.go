@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// cone returns a heightfield with a cone of the given height in the middle
+func cone(size int, height float64) heightfield {
+	h := heightfield{Width: size, Height: size, Z: make([]float64, size*size)}
+	c := float64(size-1) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			h.Z[y*size+x] = math.Max(0, height*(1-math.Hypot(float64(x)-c, float64(y)-c)/c))
+		}
+	}
+	return h
+}
+
+func TestContours(t *testing.T) {
+	// levels 0 and 100 would only touch the border and the tip
+	h := cone(41, 100)
+	tests := []struct {
+		interval, start float64
+		levels          []float64
+	}{
+		{25, 5, []float64{5, 30, 55, 80}},
+		{30, 20, []float64{20, 50, 80}},
+		{40, -70, []float64{10, 50, 90}},
+		{0, 0, nil},
+		{-5, 0, nil},
+		{math.NaN(), 0, nil},
+	}
+	for _, tt := range tests {
+		var levels []float64
+		for _, l := range contours(h, tt.interval, tt.start) {
+			if len(levels) == 0 || levels[len(levels)-1] != l.Level {
+				levels = append(levels, l.Level)
+			}
+		}
+		if !reflect.DeepEqual(levels, tt.levels) {
+			t.Errorf("interval %g start %g: levels %v, want %v", tt.interval, tt.start, levels, tt.levels)
+		}
+	}
+}
+
+func TestContourLinesOfCone(t *testing.T) {
+	h := cone(41, 100)
+	for _, l := range contours(h, 50, 0) {
+		if l.Level != 50 {
+			continue
+		}
+		if !l.Closed {
+			t.Errorf("level 50 not closed")
+		}
+		// the circle of level 50 has half the radius of the cone
+		for _, p := range l.Points {
+			if r := math.Hypot(p[0]-20, p[1]-20); math.Abs(r-10) > 0.5 {
+				t.Errorf("point %v at radius %g, want 10", p, r)
+			}
+		}
+		return
+	}
+	t.Error("no line at level 50")
+}
+
+func TestContoursSkipInvalid(t *testing.T) {
+	h := cone(41, 100)
+	for i := range h.Z {
+		if i%41 < 20 {
+			h.Z[i] = math.NaN()
+		}
+	}
+	for _, l := range contours(h, 50, 0) {
+		for _, p := range l.Points {
+			if p[0] < 20 {
+				t.Errorf("point %v in invalid pixels", p)
+			}
+		}
+		if l.Level == 50 && l.Closed {
+			t.Error("line through invalid pixels closed")
+		}
+	}
+}
+
+func TestContourIntervalLimits(t *testing.T) {
+	for _, tt := range []struct {
+		interval float64
+		ok       bool
+	}{{0, true}, {1, true}, {10, true}, {0.5, false}, {0.0001, false}, {-1, false}, {math.NaN(), false}} {
+		if err := validContourInterval(tt.interval); (err == nil) != tt.ok {
+			t.Errorf("interval %g: got error %v, want ok %v", tt.interval, err, tt.ok)
+		}
+	}
+
+	// 4000 levels are coarsened to at most maxContourLevels on the requested grid
+	h := cone(41, 4000)
+	levels := map[float64]bool{}
+	for _, l := range contours(h, 1, 0) {
+		levels[l.Level] = true
+	}
+	if len(levels) > maxContourLevels+1 {
+		t.Errorf("%d levels, want at most %d", len(levels), maxContourLevels+1)
+	}
+	for level := range levels {
+		if level != math.Trunc(level) {
+			t.Errorf("level %g off the 1 mm grid", level)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// demOptions hold the fake georeference of an exported raster.
+// The sandbox has no real location, so by default it is placed at the origin
+// with a cell size of 1.7 map units, the size of a pixel on the sand in mm.
+// EPSG:3857 counts in metres, so by default a millimetre on the sand is a
+// metre on the map, like a 1:1000 model; heights stay in mm.
+type demOptions struct {
+	OriginX  float64 // map x of the upper left corner
+	OriginY  float64 // map y of the upper left corner
+	CellSize float64 // map units per pixel
+	EPSG     int     // projected coordinate system
+	NoData   float64 // value written for invalid pixels
+}
+
+// EPSG codes of projected coordinate systems GeoTIFF can store
+const (
+	minEPSG = 1024
+	maxEPSG = 32766
+)
+
+func demOptionsFromQuery(c *gin.Context) (demOptions, error) {
+	opt := demOptions{
+		OriginX:  queryFloat(c, "originx", 0),
+		OriginY:  queryFloat(c, "originy", 0),
+		CellSize: queryFloat(c, "cellsize", 1.7),
+		EPSG:     queryInt(c, "epsg", 3857),
+		NoData:   queryFloat(c, "nodata", -9999),
+	}
+	// an extent overrides the cell size so the whole frame spans it
+	if extent := queryFloat(c, "extent", 0); extent > 0 {
+		opt.CellSize = extent / frameWidth
+	}
+	if opt.CellSize <= 0 {
+		return opt, errors.New("cellsize must be positive")
+	}
+	if opt.EPSG < minEPSG || opt.EPSG > maxEPSG {
+		return opt, fmt.Errorf("epsg must be a projected coordinate system code from %d to %d", minEPSG, maxEPSG)
+	}
+	return opt, nil
+}
+
+// demRaster returns the raster values of the current frame, either as
+// baseline-relative height (default) or as raw depth in mm (value=depth)
+func demRaster(c *gin.Context, nodata float64) []float32 {
+	depth := freenect_device.DepthArray16(false)
+	raster := make([]float32, len(depth))
+	if c.Request.URL.Query().Get("value") == "depth" {
+		for i, d := range depth {
+			if d == 0 {
+				raster[i] = float32(nodata)
+				continue
+			}
+			raster[i] = float32(d)
+		}
+		return raster
+	}
+	h := newHeightfield(depth, queryFloat(c, "base", 0))
+	for i, z := range h.Z {
+		if math.IsNaN(z) {
+			z = nodata
+		}
+		raster[i] = float32(z)
+	}
+	return raster
+}
+
+// writeASCIIGrid writes an ESRI ASCII grid
+func writeASCIIGrid(w io.Writer, raster []float32, width, height int, opt demOptions) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ncols %d\nnrows %d\n", width, height)
+	fmt.Fprintf(bw, "xllcorner %g\nyllcorner %g\n", opt.OriginX, opt.OriginY-float64(height)*opt.CellSize)
+	fmt.Fprintf(bw, "cellsize %g\nNODATA_value %g\n", opt.CellSize, opt.NoData)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x > 0 {
+				bw.WriteByte(' ')
+			}
+			bw.WriteString(strconv.FormatFloat(float64(raster[y*width+x]), 'g', -1, 32))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// tiff tag types
+const (
+	tiffShort  = 3
+	tiffLong   = 4
+	tiffASCII  = 2
+	tiffDouble = 12
+)
+
+type tiffTag struct {
+	id    uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func tiffShorts(id uint16, v ...uint16) tiffTag {
+	b := make([]byte, 2*len(v))
+	for i, s := range v {
+		binary.LittleEndian.PutUint16(b[2*i:], s)
+	}
+	return tiffTag{id, tiffShort, uint32(len(v)), b}
+}
+
+func tiffLongs(id uint16, v ...uint32) tiffTag {
+	b := make([]byte, 4*len(v))
+	for i, l := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], l)
+	}
+	return tiffTag{id, tiffLong, uint32(len(v)), b}
+}
+
+func tiffDoubles(id uint16, v ...float64) tiffTag {
+	b := make([]byte, 8*len(v))
+	for i, d := range v {
+		binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(d))
+	}
+	return tiffTag{id, tiffDouble, uint32(len(v)), b}
+}
+
+func tiffString(id uint16, s string) tiffTag {
+	b := append([]byte(s), 0)
+	return tiffTag{id, tiffASCII, uint32(len(b)), b}
+}
+
+// writeGeoTIFF writes a single band float32 GeoTIFF with one strip
+func writeGeoTIFF(w io.Writer, raster []float32, width, height int, opt demOptions) error {
+	const headerSize = 8
+	imageSize := uint32(len(raster) * 4)
+
+	tags := []tiffTag{
+		tiffLongs(256, uint32(width)),                            // ImageWidth
+		tiffLongs(257, uint32(height)),                           // ImageLength
+		tiffShorts(258, 32),                                      // BitsPerSample
+		tiffShorts(259, 1),                                       // Compression none
+		tiffShorts(262, 1),                                       // Photometric BlackIsZero
+		tiffLongs(273, headerSize),                               // StripOffsets, image follows the header
+		tiffShorts(277, 1),                                       // SamplesPerPixel
+		tiffLongs(278, uint32(height)),                           // RowsPerStrip
+		tiffLongs(279, imageSize),                                // StripByteCounts
+		tiffShorts(284, 1),                                       // PlanarConfiguration
+		tiffShorts(339, 3),                                       // SampleFormat IEEE float
+		tiffDoubles(33550, opt.CellSize, opt.CellSize, 0),        // ModelPixelScale
+		tiffDoubles(33922, 0, 0, 0, opt.OriginX, opt.OriginY, 0), // ModelTiepoint
+		tiffShorts(34735, 1, 1, 0, 3, // GeoKeyDirectory header, 3 keys
+			1024, 0, 1, 1, // GTModelType projected
+			1025, 0, 1, 1, // GTRasterType PixelIsArea
+			3072, 0, 1, uint16(opt.EPSG)), // ProjectedCSType
+		tiffString(42113, strconv.FormatFloat(opt.NoData, 'g', -1, 64)), // GDAL_NODATA
+	}
+
+	// layout: header, image data, IFD, out of line tag values
+	ifdOffset := uint32(headerSize) + imageSize
+	ifdSize := uint32(2 + len(tags)*12 + 4)
+	extraOffset := ifdOffset + ifdSize
+
+	var ifd, extra bytes.Buffer
+	binary.Write(&ifd, binary.LittleEndian, uint16(len(tags)))
+	for _, t := range tags {
+		binary.Write(&ifd, binary.LittleEndian, t.id)
+		binary.Write(&ifd, binary.LittleEndian, t.typ)
+		binary.Write(&ifd, binary.LittleEndian, t.count)
+		if len(t.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, t.data)
+			ifd.Write(value)
+			continue
+		}
+		binary.Write(&ifd, binary.LittleEndian, extraOffset+uint32(extra.Len()))
+		extra.Write(t.data)
+		if extra.Len()%2 == 1 {
+			extra.WriteByte(0)
+		}
+	}
+	binary.Write(&ifd, binary.LittleEndian, uint32(0)) // no further IFD
+
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{'I', 'I', 42, 0})
+	binary.Write(bw, binary.LittleEndian, ifdOffset)
+	if err := binary.Write(bw, binary.LittleEndian, raster); err != nil {
+		return err
+	}
+	bw.Write(ifd.Bytes())
+	bw.Write(extra.Bytes())
+	return bw.Flush()
+}
+
+// GetDEM godoc
+// @Summary Get Digital Elevation Model
+// @Description gets the current frame as GeoTIFF (float32) or ESRI ASCII grid
+// @Produce  octet-stream
+// @Param format path string true "tif or asc"
+// @Param value query string false "height (default, relative to base) or depth in mm"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Param originx query number false "Map x of the upper left corner, default 0"
+// @Param originy query number false "Map y of the upper left corner, default 0"
+// @Param cellsize query number false "Map units per pixel, default 1.7"
+// @Param extent query number false "Map width of the frame, overrides cellsize"
+// @Param epsg query int false "EPSG code of the projected coordinate system from 1024 to 32766, default 3857 (metres)"
+// @Param nodata query number false "Value for invalid pixels, default -9999"
+// @Success 200 byte raster
+// @Failure 400 {object} string
+// @Failure 404 {object} string
+// @Router /export/dem.{format} [get]
+func GetDEM(c *gin.Context) {
+	opt, err := demOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	var write func(io.Writer, []float32, int, int, demOptions) error
+	ext := path.Ext(c.Request.URL.Path)
+	switch ext {
+	case ".tif":
+		c.Writer.Header().Set("Content-Type", "image/tiff")
+		write = writeGeoTIFF
+	case ".asc":
+		c.Writer.Header().Set("Content-Type", "text/plain")
+		write = writeASCIIGrid
+	default:
+		c.Data(404, "", nil)
+		return
+	}
+	freenect_device.SetLed(freenect.LED_GREEN)
+	raster := demRaster(c, opt.NoData)
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand-dem"+ext)
+	if err := write(c.Writer, raster, frameWidth, frameHeight, opt); err != nil {
+		log.Println(err)
+	}
+	freenect_device.SetLed(freenect.LED_OFF)
+}
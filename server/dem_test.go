@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// readTIFFTags returns the values of the first IFD of a little endian TIFF by
+// tag id, out of line values resolved
+func readTIFFTags(t *testing.T, b []byte) map[uint16][]byte {
+	if string(b[:4]) != "II*\x00" {
+		t.Fatalf("not a little endian TIFF: % x", b[:4])
+	}
+	le := binary.LittleEndian
+	ifd := le.Uint32(b[4:])
+	sizes := map[uint16]uint32{tiffASCII: 1, tiffShort: 2, tiffLong: 4, tiffDouble: 8}
+	tags := map[uint16][]byte{}
+	count := int(le.Uint16(b[ifd:]))
+	last := uint16(0)
+	for i := 0; i < count; i++ {
+		e := b[int(ifd)+2+12*i:]
+		id, typ, n := le.Uint16(e), le.Uint16(e[2:]), le.Uint32(e[4:])
+		if id <= last {
+			t.Errorf("tag %d follows %d, tags must be sorted", id, last)
+		}
+		last = id
+		size := sizes[typ] * n
+		if size <= 4 {
+			tags[id] = e[8 : 8+size]
+		} else {
+			offset := le.Uint32(e[8:])
+			if offset%2 != 0 {
+				t.Errorf("tag %d at odd offset %d", id, offset)
+			}
+			tags[id] = b[offset : offset+size]
+		}
+	}
+	if next := le.Uint32(b[int(ifd)+2+12*count:]); next != 0 {
+		t.Errorf("next IFD at %d", next)
+	}
+	return tags
+}
+
+func TestGeoTIFF(t *testing.T) {
+	tests := []struct {
+		width, height int
+		opt           demOptions
+	}{
+		{3, 2, demOptions{CellSize: 1.7, EPSG: 3857, NoData: -9999}},
+		{640, 480, demOptions{OriginX: 500000, OriginY: 5400000, CellSize: 0.5, EPSG: 32632, NoData: math.NaN()}},
+	}
+	for _, tt := range tests {
+		raster := make([]float32, tt.width*tt.height)
+		for i := range raster {
+			raster[i] = float32(i) / 4
+		}
+		var buf bytes.Buffer
+		if err := writeGeoTIFF(&buf, raster, tt.width, tt.height, tt.opt); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		tags := readTIFFTags(t, b)
+		le := binary.LittleEndian
+		long := func(id uint16) uint32 { return le.Uint32(tags[id]) }
+		short := func(id uint16) uint16 { return le.Uint16(tags[id]) }
+		doubles := func(id uint16) []float64 {
+			var v []float64
+			for i := 0; i < len(tags[id]); i += 8 {
+				v = append(v, math.Float64frombits(le.Uint64(tags[id][i:])))
+			}
+			return v
+		}
+
+		if long(256) != uint32(tt.width) || long(257) != uint32(tt.height) || long(278) != uint32(tt.height) {
+			t.Errorf("%dx%d: size tags %d x %d, %d rows per strip", tt.width, tt.height, long(256), long(257), long(278))
+		}
+		if short(258) != 32 || short(339) != 3 || short(277) != 1 {
+			t.Errorf("%dx%d: not single band float32", tt.width, tt.height)
+		}
+		offset, size := long(273), long(279)
+		if size != uint32(4*len(raster)) {
+			t.Errorf("%dx%d: strip of %d bytes", tt.width, tt.height, size)
+		}
+		strip := make([]float32, len(raster))
+		binary.Read(bytes.NewReader(b[offset:offset+size]), le, strip)
+		if !reflect.DeepEqual(strip, raster) {
+			t.Errorf("%dx%d: strip differs from the raster", tt.width, tt.height)
+		}
+		if got := doubles(33550); !reflect.DeepEqual(got, []float64{tt.opt.CellSize, tt.opt.CellSize, 0}) {
+			t.Errorf("%dx%d: pixel scale %v", tt.width, tt.height, got)
+		}
+		if got := doubles(33922); !reflect.DeepEqual(got, []float64{0, 0, 0, tt.opt.OriginX, tt.opt.OriginY, 0}) {
+			t.Errorf("%dx%d: tiepoint %v", tt.width, tt.height, got)
+		}
+		keys := tags[34735]
+		if len(keys) != 32 || le.Uint16(keys[30:]) != uint16(tt.opt.EPSG) {
+			t.Errorf("%dx%d: geo keys % x", tt.width, tt.height, keys)
+		}
+		nodata := string(bytes.TrimRight(tags[42113], "\x00"))
+		if want := map[bool]string{true: "NaN", false: "-9999"}[math.IsNaN(tt.opt.NoData)]; nodata != want {
+			t.Errorf("%dx%d: nodata %q, want %q", tt.width, tt.height, nodata, want)
+		}
+	}
+}
+
+func TestDEMOptionsFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  demOptions
+		err   bool
+	}{
+		{"", demOptions{CellSize: 1.7, EPSG: 3857, NoData: -9999}, false},
+		{"?epsg=32632&extent=320&originx=5&nodata=0", demOptions{OriginX: 5, CellSize: 0.5, EPSG: 32632, NoData: 0}, false},
+		{"?epsg=1024", demOptions{CellSize: 1.7, EPSG: 1024, NoData: -9999}, false},
+		{"?epsg=65536", demOptions{}, true},
+		{"?epsg=69393", demOptions{}, true}, // 3857 after truncating to 16 bits
+		{"?epsg=-3857", demOptions{}, true},
+		{"?epsg=0", demOptions{}, true},
+		{"?epsg=32767", demOptions{}, true},
+		{"?cellsize=0", demOptions{}, true},
+		{"?cellsize=-2", demOptions{}, true},
+	}
+	for _, tt := range tests {
+		c, _ := testContext("GET", "/export/dem.tif"+tt.query, "127.0.0.1:5000", nil)
+		opt, err := demOptionsFromQuery(c)
+		if (err != nil) != tt.err || !tt.err && opt != tt.want {
+			t.Errorf("%q: %+v, %v", tt.query, opt, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// terrain derivatives computed per pixel from the heightfield
+const (
+	derivativeSlope   = "slope"   // degrees from horizontal
+	derivativeAspect  = "aspect"  // degrees clockwise from north (image top), -1 for flat
+	derivativeProfile = "profile" // curvature along the slope, 1/mm
+	derivativePlan    = "plan"    // curvature across the slope, 1/mm
+)
+
+var derivatives = []string{derivativeSlope, derivativeAspect, derivativeProfile, derivativePlan}
+
+// window returns the 3x3 neighbourhood of a pixel, top row first.
+// Invalid or border neighbours fall back to the center height.
+func (h heightfield) window(x, y int) [9]float64 {
+	var w [9]float64
+	center := h.At(x, y)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			z := center
+			if nx >= 0 && ny >= 0 && nx < h.Width && ny < h.Height && h.Valid(nx, ny) {
+				z = h.At(nx, ny)
+			}
+			w[(dy+1)*3+dx+1] = z
+		}
+	}
+	return w
+}
+
+// curvature returns profile and plan curvature after Zevenbergen and Thorne
+func curvature(z [9]float64, cellsize float64) (float64, float64) {
+	l2 := cellsize * cellsize
+	d := ((z[3]+z[5])/2 - z[4]) / l2
+	e := ((z[1]+z[7])/2 - z[4]) / l2
+	f := (-z[0] + z[2] + z[6] - z[8]) / (4 * l2)
+	g := (z[5] - z[3]) / (2 * cellsize)
+	h := (z[1] - z[7]) / (2 * cellsize)
+	gh := g*g + h*h
+	if gh == 0 {
+		return 0, 0
+	}
+	profile := -2 * (d*g*g + e*h*h + f*g*h) / gh
+	plan := 2 * (d*h*h + e*g*g - f*g*h) / gh
+	return profile, plan
+}
+
+// derivative computes one derivative for every pixel, invalid pixels are NaN
+func derivative(h heightfield, kind string, cellsize float64) []float32 {
+	values := make([]float32, len(h.Z))
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			i := y*h.Width + x
+			if !h.Valid(x, y) {
+				values[i] = float32(math.NaN())
+				continue
+			}
+			var v float64
+			switch kind {
+			case derivativeSlope:
+				dzdx, dzdy := h.Gradient(x, y, cellsize)
+				v = math.Atan(math.Hypot(dzdx, dzdy)) * 180 / math.Pi
+			case derivativeAspect:
+				dzdx, dzdy := h.Gradient(x, y, cellsize)
+				v = -1
+				if dzdx != 0 || dzdy != 0 {
+					// downslope direction, north is up in the image
+					v = math.Mod(math.Atan2(-dzdx, dzdy)*180/math.Pi+360, 360)
+				}
+			case derivativeProfile:
+				v, _ = curvature(h.window(x, y), cellsize)
+			case derivativePlan:
+				_, v = curvature(h.window(x, y), cellsize)
+			}
+			values[i] = float32(v)
+		}
+	}
+	return values
+}
+
+// normalMap encodes tangent space normals as RGB with green pointing to the image top
+func normalMap(h heightfield, cellsize, strength float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, h.Width, h.Height))
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			if !h.Valid(x, y) {
+				img.SetRGBA(x, y, color.RGBA{R: 128, G: 128, B: 255, A: 0xff})
+				continue
+			}
+			dzdx, dzdy := h.Gradient(x, y, cellsize)
+			nx, ny, nz := -dzdx*strength, dzdy*strength, 1.0
+			l := math.Sqrt(nx*nx + ny*ny + nz*nz)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8((nx/l + 1) / 2 * 255),
+				G: uint8((ny/l + 1) / 2 * 255),
+				B: uint8((nz/l + 1) / 2 * 255),
+				A: 0xff,
+			})
+		}
+	}
+	return img
+}
+
+// renderScalar colours values between min and max with a palette, NaN stays transparent
+func renderScalar(values []float32, width, height int, p palette, min, max float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, v := range values {
+		if math.IsNaN(float64(v)) {
+			continue
+		}
+		t := 0.0
+		if max > min {
+			t = (float64(v) - min) / (max - min)
+		}
+		img.SetRGBA(i%width, i/width, p[int(math.Max(0, math.Min(1, t))*255)])
+	}
+	return img
+}
+
+// derivativeChannels packs the requested derivatives as little endian float32 rasters
+func derivativeChannels(h heightfield, kinds []string, cellsize float64) map[string][]byte {
+	if len(kinds) == 0 {
+		return nil
+	}
+	channels := map[string][]byte{}
+	for _, kind := range kinds {
+		values := derivative(h, kind, cellsize)
+		b := make([]byte, 4*len(values))
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+		}
+		channels[kind] = b
+	}
+	return channels
+}
+
+// GetDerivative renders slope, aspect, curvature or a normal map of the current frame as PNG
+func GetDerivative(c *gin.Context) {
+	kind := c.Params.ByName("type")
+	cellsize := queryFloat(c, "cellsize", 1.7)
+
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+	h := captureHeightfield(c)
+
+	var img *image.RGBA
+	switch kind {
+	case "normal":
+		img = normalMap(h, cellsize, queryFloat(c, "strength", 1))
+	default:
+		name := c.Request.URL.Query().Get("palette")
+		if name == "" {
+			name = "viridis"
+			if kind == derivativeAspect {
+				name = "rainbow"
+			}
+		}
+		p, ok := getPalette(name)
+		if !ok {
+			c.JSON(404, "unknown palette")
+			return
+		}
+		// default ranges, curvature is symmetric around 0
+		min, max := 0.0, 90.0
+		switch kind {
+		case derivativeAspect:
+			max = 360
+		case derivativeProfile, derivativePlan:
+			min, max = -0.05, 0.05
+		}
+		min, max = queryFloat(c, "min", min), queryFloat(c, "max", max)
+		img = renderScalar(derivative(h, kind, cellsize), h.Width, h.Height, p, min, max)
+	}
+	c.Writer.Header().Set("Content-Type", "image/png")
+	png.Encode(c.Writer, img)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// ramp returns a 5x5 heightfield rising by step per pixel to the right
+func ramp(step float64) heightfield {
+	h := heightfield{Width: 5, Height: 5, Z: make([]float64, 25)}
+	for i := range h.Z {
+		h.Z[i] = float64(i%5) * step
+	}
+	return h
+}
+
+func TestDerivativeChannels(t *testing.T) {
+	h := ramp(2)
+	h.Z[24] = math.NaN()
+	channels := derivativeChannels(h, []string{derivativeSlope, derivativeAspect}, 2)
+	tests := []struct {
+		kind  string
+		pixel int
+		want  float64
+	}{
+		{derivativeSlope, 6, 45},
+		{derivativeAspect, 6, 270}, // downslope to the left
+		{derivativeSlope, 24, math.NaN()},
+	}
+	for _, tt := range tests {
+		b := channels[tt.kind]
+		if len(b) != 4*25 {
+			t.Fatalf("%s: %d bytes", tt.kind, len(b))
+		}
+		got := float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*tt.pixel:])))
+		if math.IsNaN(tt.want) != math.IsNaN(got) || math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s at %d: got %g, want %g", tt.kind, tt.pixel, got, tt.want)
+		}
+	}
+	if derivativeChannels(h, nil, 2) != nil {
+		t.Error("channels without kinds")
+	}
+}
+
+// TestChannelEncoding checks that float channels are binary in msgpack and
+// cbor and base64 only in JSON
+func TestChannelEncoding(t *testing.T) {
+	raster := []byte{0, 0, 0x80, 0x3f, 0, 0, 0, 0x40} // 1.0, 2.0
+	p := payload{Channels: map[string][]byte{derivativeSlope: raster}}
+	for _, tt := range []struct {
+		format string
+		handle codec.Handle
+	}{{formatMsgPack, msgpackHandle}, {formatCBOR, cborHandle}} {
+		b, err := encodePayload(tt.format, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, raster) {
+			t.Errorf("%s: raster not in the payload as plain bytes", tt.format)
+		}
+		var decoded struct {
+			F map[string][]byte `codec:"f"`
+		}
+		if err := codec.NewDecoderBytes(b, tt.handle).Decode(&decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.F[derivativeSlope], raster) {
+			t.Errorf("%s: decoded %v", tt.format, decoded.F)
+		}
+	}
+	b, err := encodePayload(formatJSON, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		F map[string]string `json:"f"`
+	}
+	json.Unmarshal(b, &decoded)
+	if decoded.F[derivativeSlope] != base64.StdEncoding.EncodeToString(raster) {
+		t.Errorf("json: %s", b)
+	}
+}
@@ -27,24 +27,540 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/deptharray/": {
+        "/admin/clients": {
+            "get": {
+                "description": "Returns every client of /stream/, /mjpeg/, /events and gRPC Subscribe with its kind and address, /stream/ clients with their channels, format and stream statistics like bytes sent.\nRequires the token given with -admin-token as bearer token if set, otherwise only answers requests from localhost.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Lists connected streaming clients",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.clientInfo"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/clients/{id}": {
+            "delete": {
+                "description": "Closes the websocket of a /stream/ client with a close frame or ends the stream of other clients, requires the admin token like the listing.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Disconnects a streaming client",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Client id from the listing",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/config/": {
+            "post": {
+                "description": "returns OK",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update OpenCV Circle Detection Config",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/data/": {
             "get": {
                 "description": "gets the current frames depth array",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "application/json",
+                    "application/msgpack",
+                    "application/cbor",
+                    "application/octet-stream"
+                ],
+                "summary": "Get Depth Array",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Contour interval in mm, at least 1, contour lines are sent in l",
+                        "name": "contours",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated slope, aspect, profile, plan sent in f as float32 rasters, binary with msgpack and cbor",
+                        "name": "channels",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json, msgpack, cbor or raw, overrides the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/events": {
+            "get": {
+                "description": "Streams circles (all tracked circles whenever they change), enter and leave (single objects), config (changed detection config) and device events.\nA reconnecting client resumes after the Last-Event-ID header from an in-memory log of the latest 1000 events.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Serves server events as Server-Sent Events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma separated event types to send, default all",
+                        "name": "types",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event id if the Last-Event-ID header can't be set",
+                        "name": "lastEventId",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.event"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/cloud.{format}": {
+            "get": {
+                "description": "gets the coloured point cloud of the registered depth and RGB frames as PCD (camera space) or LAS 1.2 (z-up, height above base)",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Get Point Cloud",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "pcd or las",
+                        "name": "format",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pcd only: binary (default) or ascii",
+                        "name": "data",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Pixel subsampling, default 1",
+                        "name": "step",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "las only: distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/contours.{format}": {
+            "get": {
+                "description": "gets contour lines of the current frame as GeoJSON, SVG or DXF",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get Contour Lines",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "geojson, svg or dxf",
+                        "name": "format",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Contour interval in mm, default 10, at least 1",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Base contour level in mm, default 0",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/dem.{format}": {
+            "get": {
+                "description": "gets the current frame as GeoTIFF (float32) or ESRI ASCII grid",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Get Digital Elevation Model",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "tif or asc",
+                        "name": "format",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "height (default, relative to base) or depth in mm",
+                        "name": "value",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Map x of the upper left corner, default 0",
+                        "name": "originx",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Map y of the upper left corner, default 0",
+                        "name": "originy",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Map units per pixel, default 1.7",
+                        "name": "cellsize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Map width of the frame, overrides cellsize",
+                        "name": "extent",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "EPSG code of the projected coordinate system from 1024 to 32766, default 3857 (metres)",
+                        "name": "epsg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Value for invalid pixels, default -9999",
+                        "name": "nodata",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/depth.npy": {
+            "get": {
+                "description": "gets the depth frame in millimetres as .npy file with shape (480, 640)",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Get Depth as NumPy Array",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "uint16 (default) or float32, float32 marks invalid pixels as NaN",
+                        "name": "dtype",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/mesh.stl": {
+            "get": {
+                "description": "gets the current depth frame as binary STL mesh, mode=solid closes it into a printable solid",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Get Mesh as STL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "surface (default) or solid",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Grid subsampling in pixels, default 2",
+                        "name": "step",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Size of a pixel on the sand in mm, default 1.7",
+                        "name": "pitch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Vertical exaggeration, default 1",
+                        "name": "exaggeration",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Target print size of the longest side in mm",
+                        "name": "size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Solid base thickness in mm, default 3",
+                        "name": "thickness",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/rgbd.zip": {
+            "get": {
+                "description": "gets a zip with 16-bit depth PNG, RGB PNG and meta.json holding intrinsics and timestamps",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "summary": "Get RGB-D Bundle",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    }
+                }
+            }
+        },
+        "/export/tin.{format}": {
+            "get": {
+                "description": "gets the current heightfield as triangulated irregular network within a max vertical error, as JSON vertices/faces or binary",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get Depth Array",
+                "summary": "Get simplified TIN mesh",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "json or bin",
+                        "name": "format",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Max vertical error in mm, default 2",
+                        "name": "error",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Size of a pixel on the sand in mm, default 1.7",
+                        "name": "pitch",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "integer"
-                            }
+                            "$ref": "#/definitions/main.tin"
                         }
                     }
                 }
@@ -60,6 +576,98 @@ var doc = `{
                     "image/jpeg"
                 ],
                 "summary": "Get Frame from Kinect",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Frame Type depth, ir, rgb, elevation, depth16.png (16-bit PNG in mm), slope, aspect, profile, plan or normal",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "elevation only: palette name, default terrain",
+                        "name": "palette",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: height in mm mapped to the first palette colour",
+                        "name": "min",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: height in mm mapped to the last palette colour",
+                        "name": "max",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: hillshade blending 0 to 1, default 0",
+                        "name": "hillshade",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: sun azimuth in degrees, default 315",
+                        "name": "azimuth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: sun altitude in degrees, default 45",
+                        "name": "altitude",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "elevation only: contour interval in mm, at least 1",
+                        "name": "contours",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "elevation only: png (default) or jpeg",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "JPEG quality 1-100, default server quality",
+                        "name": "quality",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/mjpeg/{type}/": {
+            "get": {
+                "description": "Serves frames as multipart/x-mixed-replace, all viewers share one capture loop per frame type",
+                "produces": [
+                    "multipart/x-mixed-replace"
+                ],
+                "summary": "Serves a MJPEG stream",
                 "parameters": [
                     {
                         "type": "string",
@@ -67,6 +675,18 @@ var doc = `{
                         "name": "type",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Frames per second, default 10",
+                        "name": "fps",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "JPEG quality 1-100, default server quality",
+                        "name": "quality",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -81,34 +701,212 @@ var doc = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
-        "/stream/{type}/{time}/": {
+        "/palette/": {
             "get": {
-                "description": "Serves frames continuously",
+                "description": "returns the names of built-in and uploaded palettes",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List Elevation Palettes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/palette/{name}/": {
+            "post": {
+                "description": "stores a gradient given as JSON list of 2 to 256 \"#rrggbb\" strings or [r,g,b] arrays, lowest height first\nUp to 32 palettes can be uploaded, built-in palettes can't be replaced. Requires the admin token like /admin/clients.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "image/jpeg"
+                    "application/json"
+                ],
+                "summary": "Upload Elevation Palette",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Palette name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/{time}/": {
+            "get": {
+                "description": "Serves frames continuously, multiplexing subscribed channels tagged by name in ch. The client can change the settings while streaming with JSON commands\nlike {\"cmd\":\"set\",\"id\":1,\"interval\":100,\"type\":\"rgbframe\",\"detection\":true,\"roi\":[0,0,320,240],\"filter\":{\"fill\":true,\"median\":true,\"temporal\":0.5},\"format\":\"msgpack\",\n\"change\":{\"on\":true,\"height\":1,\"pixel\":5,\"pixels\":500,\"circles\":1,\"heartbeat\":5000}}\n{\"cmd\":\"subscribe\",\"channel\":\"rgb\",\"interval\":500}, {\"cmd\":\"unsubscribe\",\"channel\":\"frame\"},\n{\"cmd\":\"next\",\"channels\":[\"frame\",\"rgb\"],\"format\":\"msgpack\"} answered with one fresh message per channel after the reply\nor {\"cmd\":\"get\"}, each answered with {\"reply\":\"set\",\"id\":1,\"ok\":true,\"settings\":{...}} or ok false and an error.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
                 ],
                 "summary": "Serves a websocket streaming kinect frames",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image sending frequency in ms, 0 sends frames on next commands only",
+                        "name": "time",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "type": "string",
-                        "description": "Frame Type deptharray, depthframe, irframe, rgbframe",
+                        "description": "Frame Type deptharray (default), depthframe, irframe, rgbframe, images are sent as JPEG in d",
                         "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Enables circle detection if set",
+                        "name": "detection",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (text messages, default), msgpack, cbor or raw (binary messages, d behind a 32 byte header)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Additional channels with interval in ms, e.g. rgb:500,circles:100,events, of frame, depth, rgb, ir, circles, contours and events",
+                        "name": "subscribe",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Contour interval in mm, at least 1, contour lines are sent in l",
+                        "name": "contours",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated slope, aspect, profile, plan sent in f as float32 rasters, binary with msgpack and cbor",
+                        "name": "channels",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sends frames only when the sandbox changes if set, tuned with the change setting",
+                        "name": "change",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "byte"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/tiles/{z}/{x}/{y}": {
+            "get": {
+                "description": "gets a quadtree tile of the heightfield as terrain-RGB PNG (heights in mm) or quantized-mesh-1.0 encoded RTIN (local frame in m, not georeferenced, no layer.json), zoom 0 to 3 in XYZ scheme",
+                "produces": [
+                    "image/png"
+                ],
+                "summary": "Get Terrain Tile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Zoom level",
+                        "name": "z",
                         "in": "path",
                         "required": true
                     },
                     {
                         "type": "integer",
-                        "description": "Image sending frequency in ms",
-                        "name": "time",
+                        "description": "Tile column",
+                        "name": "x",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tile row with extension .png or .terrain",
+                        "name": "y",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "quantized-mesh only: pixel size on the sand in mm, default 1.7",
+                        "name": "cellsize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "quantized-mesh only: max height error in mm at zoom 3, doubled per coarser level, default 2",
+                        "name": "error",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -117,6 +915,169 @@ var doc = `{
                         "schema": {
                             "type": "byte"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/tin/stream/": {
+            "get": {
+                "description": "Sends a new TIN whenever the sand moved by more than the error limit, checked every interval",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Serves a websocket streaming the simplified TIN mesh",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Max vertical error in mm, default 2",
+                        "name": "error",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Distance camera to baseline in mm, default farthest point",
+                        "name": "base",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Size of a pixel on the sand in mm, default 1.7",
+                        "name": "pitch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Check interval in ms, default 500, at least min_interval",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (text messages, default) or bin (binary messages)",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "main.clientInfo": {
+            "type": "object",
+            "properties": {
+                "channels": {
+                    "description": "subscribed channels and their interval in ms at full rate",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "connected": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "rate": {
+                    "description": "channel messages per second after slowdown",
+                    "type": "number"
+                },
+                "stats": {
+                    "$ref": "#/definitions/main.streamStats"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.event": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "object"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.streamStats": {
+            "type": "object",
+            "properties": {
+                "bytes": {
+                    "description": "bytes written",
+                    "type": "integer"
+                },
+                "dropped": {
+                    "description": "frames replaced by a newer one before they were written",
+                    "type": "integer"
+                },
+                "latency": {
+                    "description": "moving average of the time to write a message in ms",
+                    "type": "number"
+                },
+                "sent": {
+                    "description": "messages written",
+                    "type": "integer"
+                },
+                "slowdown": {
+                    "description": "factor applied to all channel intervals, 1 is full rate",
+                    "type": "number"
+                },
+                "unchanged": {
+                    "description": "frames skipped in change mode",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.tin": {
+            "type": "object",
+            "properties": {
+                "faces": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "integer"
+                        }
+                    }
+                },
+                "vertices": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "number"
+                        }
                     }
                 }
             }
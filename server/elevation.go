@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// palette maps normalized heights to 256 colours, lowest first
+type palette [256]color.RGBA
+
+type paletteStop struct {
+	at float64
+	c  color.RGBA
+}
+
+// newPalette interpolates evenly spaced or explicitly placed colour stops
+func newPalette(stops []paletteStop) palette {
+	var p palette
+	for i := range p {
+		t := float64(i) / 255
+		j := sort.Search(len(stops), func(k int) bool { return stops[k].at >= t })
+		switch {
+		case j == 0:
+			p[i] = stops[0].c
+		case j == len(stops):
+			p[i] = stops[len(stops)-1].c
+		default:
+			a, b := stops[j-1], stops[j]
+			f := (t - a.at) / (b.at - a.at)
+			p[i] = color.RGBA{
+				R: uint8(float64(a.c.R) + f*(float64(b.c.R)-float64(a.c.R)) + 0.5),
+				G: uint8(float64(a.c.G) + f*(float64(b.c.G)-float64(a.c.G)) + 0.5),
+				B: uint8(float64(a.c.B) + f*(float64(b.c.B)-float64(a.c.B)) + 0.5),
+				A: 0xff,
+			}
+		}
+	}
+	return p
+}
+
+// gradientPalette spreads colours evenly, a 255 or 256 colour list
+// like the Grasshopper component's palette maps one to one
+func gradientPalette(colors []color.RGBA) palette {
+	stops := make([]paletteStop, len(colors))
+	for i, c := range colors {
+		stops[i] = paletteStop{at: float64(i) / float64(len(colors)-1), c: c}
+	}
+	return newPalette(stops)
+}
+
+func rgb(r, g, b uint8) color.RGBA {
+	return color.RGBA{R: r, G: g, B: b, A: 0xff}
+}
+
+// limits of uploaded palettes, a 256 colour list maps one to one already
+const (
+	maxPaletteBody   = 64 << 10
+	maxPaletteColors = 256
+	maxPalettes      = 32
+)
+
+var builtinPalettes = map[string]palette{
+	"terrain": gradientPalette([]color.RGBA{rgb(0, 97, 71), rgb(16, 122, 47), rgb(232, 215, 125), rgb(161, 67, 0), rgb(130, 30, 30), rgb(255, 255, 255)}),
+	"grey":    gradientPalette([]color.RGBA{rgb(0, 0, 0), rgb(255, 255, 255)}),
+	"rainbow": gradientPalette([]color.RGBA{rgb(0, 0, 255), rgb(0, 255, 255), rgb(0, 255, 0), rgb(255, 255, 0), rgb(255, 0, 0)}),
+	"viridis": gradientPalette([]color.RGBA{rgb(68, 1, 84), rgb(59, 82, 139), rgb(33, 145, 140), rgb(94, 201, 98), rgb(253, 231, 37)}),
+}
+
+// palettes uploaded with PostPalette
+var palettes = map[string]palette{}
+var palettesMutex sync.RWMutex
+
+func getPalette(name string) (palette, bool) {
+	if p, ok := builtinPalettes[name]; ok {
+		return p, true
+	}
+	palettesMutex.RLock()
+	defer palettesMutex.RUnlock()
+	p, ok := palettes[name]
+	return p, ok
+}
+
+// parseGradient reads a JSON list of colours as "#rrggbb" strings or [r,g,b] arrays
+func parseGradient(data []byte) ([]color.RGBA, error) {
+	var hex []string
+	if err := json.Unmarshal(data, &hex); err == nil {
+		colors := make([]color.RGBA, len(hex))
+		for i, h := range hex {
+			v, err := strconv.ParseUint(strings.TrimPrefix(h, "#"), 16, 32)
+			if err != nil || len(h) != 7 || h[0] != '#' {
+				return nil, fmt.Errorf("invalid colour %q", h)
+			}
+			colors[i] = rgb(uint8(v>>16), uint8(v>>8), uint8(v))
+		}
+		return colors, nil
+	}
+	var triples [][3]uint8
+	if err := json.Unmarshal(data, &triples); err != nil {
+		return nil, err
+	}
+	colors := make([]color.RGBA, len(triples))
+	for i, t := range triples {
+		colors[i] = rgb(t[0], t[1], t[2])
+	}
+	return colors, nil
+}
+
+// hillshade returns the illumination of a pixel between 0 and 1
+func hillshade(h heightfield, x, y int, cellsize, azimuth, altitude float64) float64 {
+	dzdx, dzdy := h.Gradient(x, y, cellsize)
+	zenith := (90 - altitude) * math.Pi / 180
+	az := math.Mod(360-azimuth+90, 360) * math.Pi / 180
+	slope := math.Atan(math.Hypot(dzdx, dzdy))
+	aspect := math.Atan2(dzdy, -dzdx)
+	if aspect < 0 {
+		aspect += 2 * math.Pi
+	}
+	v := math.Cos(zenith)*math.Cos(slope) + math.Sin(zenith)*math.Sin(slope)*math.Cos(az-aspect)
+	return math.Max(0, math.Min(1, v))
+}
+
+// elevationOptions control rendering of the elevation image
+type elevationOptions struct {
+	Palette   palette
+	Min, Max  float64 // height range mapped onto the palette, equal values use the frame range
+	Hillshade float64 // blend factor 0 (off) to 1
+	Azimuth   float64 // sun azimuth in degrees clockwise from north (image top)
+	Altitude  float64 // sun altitude in degrees
+	CellSize  float64 // pixel size on the sand in mm
+	Contours  contourOptions
+}
+
+func renderElevation(h heightfield, opt elevationOptions) *image.RGBA {
+	min, max := opt.Min, opt.Max
+	if min >= max {
+		min, max = h.Range()
+	}
+	img := image.NewRGBA(image.Rect(0, 0, h.Width, h.Height))
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			if !h.Valid(x, y) {
+				continue
+			}
+			t := 0.0
+			if max > min {
+				t = (h.At(x, y) - min) / (max - min)
+			}
+			c := opt.Palette[int(math.Max(0, math.Min(1, t))*255)]
+			if opt.Hillshade > 0 {
+				shade := hillshade(h, x, y, opt.CellSize, opt.Azimuth, opt.Altitude)
+				f := 1 - opt.Hillshade + opt.Hillshade*shade
+				c.R, c.G, c.B = uint8(float64(c.R)*f), uint8(float64(c.G)*f), uint8(float64(c.B)*f)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	if opt.Contours.Interval > 0 {
+		for _, l := range contours(h, opt.Contours.Interval, opt.Contours.Start) {
+			for i := 1; i < len(l.Points); i++ {
+				drawLine(img, l.Points[i-1], l.Points[i], color.RGBA{A: 0xff})
+			}
+		}
+	}
+	return img
+}
+
+// drawLine rasterizes a line between two pixel coordinates
+func drawLine(img *image.RGBA, a, b [2]float64, c color.RGBA) {
+	steps := int(math.Ceil(math.Max(math.Abs(b[0]-a[0]), math.Abs(b[1]-a[1]))))
+	if steps == 0 {
+		steps = 1
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		img.SetRGBA(int(a[0]+t*(b[0]-a[0])+0.5), int(a[1]+t*(b[1]-a[1])+0.5), c)
+	}
+}
+
+// GetElevation renders the current frame with a hypsometric colour ramp
+func GetElevation(c *gin.Context) {
+	name := c.Request.URL.Query().Get("palette")
+	if name == "" {
+		name = "terrain"
+	}
+	p, ok := getPalette(name)
+	if !ok {
+		c.JSON(404, "unknown palette")
+		return
+	}
+	contours, err := contourOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	opt := elevationOptions{
+		Palette:   p,
+		Min:       queryFloat(c, "min", 0),
+		Max:       queryFloat(c, "max", 0),
+		Hillshade: queryFloat(c, "hillshade", 0),
+		Azimuth:   queryFloat(c, "azimuth", 315),
+		Altitude:  queryFloat(c, "altitude", 45),
+		CellSize:  queryFloat(c, "cellsize", 1.7),
+		Contours:  contours,
+	}
+
+	quality := queryInt(c, "quality", image_quality)
+	if quality < 1 || quality > 100 {
+		quality = image_quality
+	}
+
+	freenect_device.SetLed(freenect.LED_GREEN)
+	img := renderElevation(captureHeightfield(c), opt)
+	if c.Request.URL.Query().Get("format") == "jpeg" {
+		c.Writer.Header().Set("Content-Type", "image/jpeg")
+		jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: quality})
+	} else {
+		c.Writer.Header().Set("Content-Type", "image/png")
+		png.Encode(c.Writer, img)
+	}
+	freenect_device.SetLed(freenect.LED_OFF)
+}
+
+// GetPalettes godoc
+// @Summary List Elevation Palettes
+// @Description returns the names of built-in and uploaded palettes
+// @Produce  json
+// @Success 200 {array} string
+// @Router /palette/ [get]
+func GetPalettes(c *gin.Context) {
+	names := make([]string, 0, len(builtinPalettes))
+	for name := range builtinPalettes {
+		names = append(names, name)
+	}
+	palettesMutex.RLock()
+	for name := range palettes {
+		names = append(names, name)
+	}
+	palettesMutex.RUnlock()
+	sort.Strings(names)
+	c.JSON(200, names)
+}
+
+// PostPalette godoc
+// @Summary Upload Elevation Palette
+// @Description stores a gradient given as JSON list of 2 to 256 "#rrggbb" strings or [r,g,b] arrays, lowest height first
+// @Description Up to 32 palettes can be uploaded, built-in palettes can't be replaced. Requires the admin token like /admin/clients.
+// @Accept  json
+// @Produce  json
+// @Param name path string true "Palette name"
+// @Success 200 {object} string
+// @Failure 400 {object} string
+// @Failure 401 {object} string
+// @Failure 403 {object} string
+// @Failure 409 {object} string
+// @Router /palette/{name}/ [post]
+func PostPalette(c *gin.Context) {
+	name := c.Params.ByName("name")
+	if _, ok := builtinPalettes[name]; ok {
+		c.JSON(409, "built-in palettes can't be replaced")
+		return
+	}
+	jsonData, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPaletteBody))
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	colors, err := parseGradient(jsonData)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+	if len(colors) < 2 || len(colors) > maxPaletteColors {
+		c.JSON(400, fmt.Sprintf("a gradient needs 2 to %d colours", maxPaletteColors))
+		return
+	}
+	palettesMutex.Lock()
+	defer palettesMutex.Unlock()
+	if _, ok := palettes[name]; !ok && len(palettes) >= maxPalettes {
+		c.JSON(409, fmt.Sprintf("at most %d palettes can be uploaded", maxPalettes))
+		return
+	}
+	palettes[name] = gradientPalette(colors)
+	c.JSON(200, "OK")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHillshade(t *testing.T) {
+	// rising by one cell size per pixel is a 45 degree slope, lit from 45 degrees
+	// above it's fully lit by a sun it faces and dark with the sun behind it
+	east := ramp(1.7)
+	south := heightfield{Width: 5, Height: 5, Z: make([]float64, 25)}
+	for i := range south.Z {
+		south.Z[i] = float64(i/5) * 1.7
+	}
+	flat := ramp(0)
+	tests := []struct {
+		name    string
+		h       heightfield
+		azimuth float64
+		want    float64
+	}{
+		{"flat", flat, 315, math.Sqrt2 / 2},
+		{"facing the sun in the west", east, 270, 1},
+		{"sun in the east behind the slope", east, 90, 0},
+		{"sun in the south across the slope", east, 180, 0.5},
+		{"facing the sun in the north", south, 0, 1},
+		{"sun in the south behind the slope", south, 180, 0},
+		{"sun in the north west", east, 315, math.Cos(math.Pi/4) * math.Cos(math.Pi/4) * (1 + math.Cos(math.Pi/4))},
+	}
+	for _, tt := range tests {
+		if got := hillshade(tt.h, 2, 2, 1.7, tt.azimuth, 45); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPalette(t *testing.T) {
+	grey := newPalette([]paletteStop{{0, rgb(0, 0, 0)}, {1, rgb(255, 255, 255)}})
+	for _, i := range []int{0, 1, 128, 254, 255} {
+		if c := grey[i]; c != rgb(uint8(i), uint8(i), uint8(i)) {
+			t.Errorf("grey %d: %v", i, c)
+		}
+	}
+
+	// placed stops hold their colour outside of them
+	placed := newPalette([]paletteStop{{0.2, rgb(100, 0, 0)}, {0.6, rgb(200, 40, 0)}})
+	tests := []struct {
+		i    int
+		want color.RGBA
+	}{
+		{0, rgb(100, 0, 0)},
+		{51, rgb(100, 0, 0)},
+		{102, rgb(150, 20, 0)},
+		{153, rgb(200, 40, 0)},
+		{255, rgb(200, 40, 0)},
+	}
+	for _, tt := range tests {
+		if placed[tt.i] != tt.want {
+			t.Errorf("placed %d: %v, want %v", tt.i, placed[tt.i], tt.want)
+		}
+	}
+
+	// evenly spread: red at 0, green at 0.5, blue at 1
+	rgbPalette := gradientPalette([]color.RGBA{rgb(255, 0, 0), rgb(0, 255, 0), rgb(0, 0, 255)})
+	if c := rgbPalette[51]; c != rgb(153, 102, 0) {
+		t.Errorf("between red and green %v", c)
+	}
+	if rgbPalette[0] != rgb(255, 0, 0) || rgbPalette[255] != rgb(0, 0, 255) {
+		t.Errorf("ends %v %v", rgbPalette[0], rgbPalette[255])
+	}
+
+	// a 256 colour list maps one to one
+	colors := make([]color.RGBA, 256)
+	for i := range colors {
+		colors[i] = rgb(uint8(i), uint8(255-i), uint8(i*7))
+	}
+	p := gradientPalette(colors)
+	for i, c := range colors {
+		if p[i] != c {
+			t.Fatalf("256 colours %d: %v, want %v", i, p[i], c)
+		}
+	}
+}
+
+func TestParseGradient(t *testing.T) {
+	tests := []struct {
+		data string
+		want []color.RGBA
+		err  bool
+	}{
+		{`["#000000","#ff8000","#FFFFFF"]`, []color.RGBA{rgb(0, 0, 0), rgb(255, 128, 0), rgb(255, 255, 255)}, false},
+		{`[[0,0,0],[255,128,0],[255,255,255]]`, []color.RGBA{rgb(0, 0, 0), rgb(255, 128, 0), rgb(255, 255, 255)}, false},
+		{`[]`, []color.RGBA{}, false},
+		{`["#fff","#000000"]`, nil, true},
+		{`["red","blue"]`, nil, true},
+		{`["#00000g","#000000"]`, nil, true},
+		{`[[256,0,0],[0,0,0]]`, nil, true},
+		{`[[-1,0,0],[0,0,0]]`, nil, true},
+		{`["#000000",[0,0,0]]`, nil, true},
+		{`["#+00000","#000000"]`, nil, true},
+		{`["#0000001","#000000"]`, nil, true},
+		{`{"colors":[]}`, nil, true},
+		{`not json`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseGradient([]byte(tt.data))
+		if (err != nil) != tt.err {
+			t.Errorf("%s: %v", tt.data, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.data, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: %v, want %v", tt.data, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPostPalette(t *testing.T) {
+	palettesMutex.Lock()
+	saved := palettes
+	palettes = map[string]palette{}
+	palettesMutex.Unlock()
+	defer func() {
+		palettesMutex.Lock()
+		palettes = saved
+		palettesMutex.Unlock()
+	}()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/palette/:name/", PostPalette)
+	post := func(name, body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/palette/"+name+"/", strings.NewReader(body)))
+		return w.Code
+	}
+
+	many := "[" + strings.Repeat(`"#000000",`, 256) + `"#ffffff"]`
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"sand", `["#000000","#ffffff"]`, 200},
+		{"sand", `[[0,0,0],[10,10,10],[255,255,255]]`, 200},
+		{"terrain", `["#000000","#ffffff"]`, 409},
+		{"one", `["#000000"]`, 400},
+		{"many", many, 400},
+		{"huge", `["#000000","#ffffff"` + strings.Repeat(" ", maxPaletteBody) + `]`, 400},
+		{"invalid", `["#000000",`, 400},
+	}
+	for _, tt := range tests {
+		if got := post(tt.name, tt.body); got != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if p, ok := getPalette("sand"); !ok || p[255] != rgb(255, 255, 255) || p[127] != rgb(10, 10, 10) {
+		t.Errorf("uploaded palette %v %v %v", ok, p[0], p[127])
+	}
+	if p, ok := getPalette("terrain"); !ok || p != builtinPalettes["terrain"] {
+		t.Error("built-in palette replaced")
+	}
+
+	for i := len(palettes); i < maxPalettes; i++ {
+		if code := post(fmt.Sprint("p", i), `["#000000","#ffffff"]`); code != 200 {
+			t.Fatalf("palette %d: %d", i, code)
+		}
+	}
+	if code := post("toomany", `["#000000","#ffffff"]`); code != 409 {
+		t.Errorf("palette over the limit: %d", code)
+	}
+	if code := post("sand", `["#ffffff","#000000"]`); code != 200 {
+		t.Errorf("replacing an uploaded palette at the limit: %d", code)
+	}
+}
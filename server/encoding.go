@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// payload encodings, by format name
+const (
+	formatJSON    = "json"
+	formatMsgPack = "msgpack"
+	formatCBOR    = "cbor"
+	formatRaw     = "raw"
+)
+
+var formatMIMETypes = map[string]string{
+	formatJSON:    "application/json",
+	formatMsgPack: "application/msgpack",
+	formatCBOR:    "application/cbor",
+	formatRaw:     "application/octet-stream",
+}
+
+// rawHeaderSize is the size of the header in front of d in raw stream messages
+const rawHeaderSize = 32
+
+// rawUnits are the units of d in raw stream messages, by the u of payloads
+var rawUnits = map[string]uint8{
+	unitsDepthArray: 0,
+	unitsJPEG:       1,
+}
+
+var errRawTerrain = errors.New("the raw format carries d only, use json, msgpack or cbor for circles, contours and channels")
+
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+var cborHandle = &codec.CborHandle{}
+
+// negotiateFormat picks the payload encoding from the format parameter or the Accept header
+func negotiateFormat(c *gin.Context) string {
+	if f := c.Request.URL.Query().Get("format"); f != "" {
+		if _, ok := formatMIMETypes[f]; ok {
+			return f
+		}
+	}
+	switch c.NegotiateFormat(
+		formatMIMETypes[formatJSON],
+		formatMIMETypes[formatMsgPack],
+		"application/x-msgpack",
+		formatMIMETypes[formatCBOR],
+		formatMIMETypes[formatRaw],
+	) {
+	case formatMIMETypes[formatMsgPack], "application/x-msgpack":
+		return formatMsgPack
+	case formatMIMETypes[formatCBOR]:
+		return formatCBOR
+	case formatMIMETypes[formatRaw]:
+		return formatRaw
+	}
+	return formatJSON
+}
+
+// encodePayload encodes a payload or other message as JSON, MessagePack or CBOR.
+// Field names are the same short json keys for all of them.
+func encodePayload(format string, p interface{}) ([]byte, error) {
+	var b []byte
+	switch format {
+	case formatMsgPack:
+		err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(p)
+		return b, err
+	case formatCBOR:
+		err := codec.NewEncoderBytes(&b, cborHandle).Encode(p)
+		return b, err
+	}
+	return json.Marshal(p)
+}
+
+// writePayload responds with the payload in the negotiated format. The raw format
+// sends the plain depth bytes and puts the metadata into headers.
+func writePayload(c *gin.Context, p payload) {
+	format := negotiateFormat(c)
+	if format == formatRaw {
+		if terrain, _ := terrainOptionsFromQuery(c); p.Contours != nil || p.Channels != nil || terrain.enabled() {
+			c.JSON(400, errRawTerrain.Error())
+			return
+		}
+		circles, _ := json.Marshal(p.Circles)
+		c.Header("X-Gosand-Width", strconv.Itoa(frameWidth))
+		c.Header("X-Gosand-Height", strconv.Itoa(frameHeight))
+		c.Header("X-Gosand-Type", "uint8")
+		c.Header("X-Gosand-Circles", string(circles))
+		c.Header("X-Gosand-Device-Time", strconv.FormatUint(uint64(p.DeviceTime), 10))
+		c.Header("X-Gosand-Time", strconv.FormatInt(p.Time, 10))
+		c.Header("X-Gosand-Seq", strconv.FormatUint(p.Seq, 10))
+		c.Header("X-Gosand-Config-Version", strconv.FormatUint(p.Config, 10))
+		c.Data(200, formatMIMETypes[formatRaw], p.Depthframe)
+		return
+	}
+	b, err := encodePayload(format, p)
+	if err != nil {
+		c.JSON(500, err)
+		return
+	}
+	c.Data(200, formatMIMETypes[format], b)
+}
+
+// rawMessage puts a little endian header in front of d, so clients can tell
+// the channels of a socket apart:
+//
+//	0  channel, index in streamChannels: 0 frame, 1 depth, 2 rgb, 3 ir
+//	1  units of d, 0 mm8 or 1 jpeg
+//	2  width
+//	4  height
+//	6  message number of the channel, wraps around
+//	8  size of d in bytes
+//	12 device timestamp
+//	16 frame sequence number
+//	24 server time the frame was taken in ms since the epoch
+func rawMessage(p payload) []byte {
+	b := make([]byte, rawHeaderSize, rawHeaderSize+len(p.Depthframe))
+	for i, name := range streamChannels {
+		if name == p.Channel {
+			b[0] = uint8(i)
+		}
+	}
+	b[1] = rawUnits[p.Units]
+	binary.LittleEndian.PutUint16(b[2:], uint16(p.Width))
+	binary.LittleEndian.PutUint16(b[4:], uint16(p.Height))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(p.Depthframe)))
+	binary.LittleEndian.PutUint32(b[12:], p.DeviceTime)
+	binary.LittleEndian.PutUint64(b[16:], p.Seq)
+	binary.LittleEndian.PutUint64(b[24:], uint64(p.Time))
+	return append(b, p.Depthframe...)
+}
+
+// encodeMessage encodes a payload for a websocket, JSON as text message and
+// the other formats as binary message. Raw sends d of payloads carrying it
+// behind a raw header and falls back to JSON for everything else.
+func encodeMessage(format string, v interface{}) (message, error) {
+	if format == formatRaw {
+		if p, ok := v.(payload); ok && p.Depthframe != nil {
+			return message{kind: websocket.BinaryMessage, data: rawMessage(p)}, nil
+		}
+		format = formatJSON
+	}
+	b, err := encodePayload(format, v)
+	if format == formatJSON {
+		return message{kind: websocket.TextMessage, data: b}, err
+	}
+	return message{kind: websocket.BinaryMessage, data: b}, err
+}
+
+// numbered returns a copy of an encoded stream message with n added, the
+// number of the message within its channel for one client. Messages are
+// shared by clients, so n is spliced into the encoding instead of encoding
+// the payload again.
+func numbered(format string, m message, n uint64) (message, error) {
+	if m.kind == websocket.TextMessage {
+		format = formatJSON
+	}
+	var b []byte
+	switch format {
+	case formatJSON:
+		if len(m.data) < 2 || m.data[0] != '{' {
+			return m, errors.New("not a JSON object")
+		}
+		b = append(b, `{"n":`...)
+		b = strconv.AppendUint(b, n, 10)
+		if m.data[1] != '}' {
+			b = append(b, ',')
+		}
+		b = append(b, m.data[1:]...)
+	case formatRaw:
+		if len(m.data) < rawHeaderSize {
+			return m, errors.New("raw message without header")
+		}
+		b = append(b, m.data...)
+		binary.LittleEndian.PutUint16(b[6:], uint16(n))
+	case formatMsgPack, formatCBOR:
+		var err error
+		if b, err = numberedMap(format, m.data, n); err != nil {
+			return m, err
+		}
+	}
+	m.data = b
+	return m, nil
+}
+
+// numberedMap adds the key n to an encoded MessagePack or CBOR map
+func numberedMap(format string, data []byte, n uint64) ([]byte, error) {
+	errMap := errors.New("not a " + format + " map")
+	if len(data) == 0 {
+		return nil, errMap
+	}
+	var count uint64
+	size := 1
+	head := data[0]
+	if format == formatMsgPack {
+		switch {
+		case head&0xf0 == 0x80:
+			count = uint64(head & 0x0f)
+		case head == 0xde && len(data) >= 3:
+			count, size = uint64(binary.BigEndian.Uint16(data[1:])), 3
+		case head == 0xdf && len(data) >= 5:
+			count, size = uint64(binary.BigEndian.Uint32(data[1:])), 5
+		default:
+			return nil, errMap
+		}
+	} else {
+		switch info := head & 0x1f; {
+		case head>>5 != 5:
+			return nil, errMap
+		case info < 24:
+			count = uint64(info)
+		case info == 31:
+			count = 0 // indefinite length, the pair is added as is
+		case info <= 27 && len(data) >= 1+1<<(info-24):
+			size = 1 + 1<<(info-24)
+			for _, c := range data[1:size] {
+				count = count<<8 | uint64(c)
+			}
+		default:
+			return nil, errMap
+		}
+	}
+
+	var b []byte
+	if format == formatMsgPack {
+		switch count++; {
+		case count < 16:
+			b = append(b, 0x80|byte(count))
+		case count < 1<<16:
+			b = append(b, 0xde, byte(count>>8), byte(count))
+		default:
+			b = append(b, 0xdf, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(b[1:], uint32(count))
+		}
+	} else if head&0x1f == 31 {
+		b = append(b, head)
+	} else {
+		switch count++; {
+		case count < 24:
+			b = append(b, 0xa0|byte(count))
+		case count < 1<<8:
+			b = append(b, 0xb8, byte(count))
+		case count < 1<<16:
+			b = append(b, 0xb9, byte(count>>8), byte(count))
+		default:
+			b = append(b, 0xba, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(b[1:], uint32(count))
+		}
+	}
+	pair, err := encodePayload(format, "n")
+	if err != nil {
+		return nil, err
+	}
+	value, err := encodePayload(format, n)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, pair...)
+	b = append(b, value...)
+	return append(b, data[size:]...), nil
+}
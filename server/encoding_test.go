@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+func TestRawMessage(t *testing.T) {
+	tests := []struct {
+		p       payload
+		channel uint8
+		units   uint8
+	}{
+		{payload{Channel: channelFrame, Depthframe: []byte{1, 2, 3}, frameMeta: frameMeta{Seq: 7, DeviceTime: 99, Time: 1600000000000, Width: 3, Height: 1, Units: unitsDepthArray}}, 0, 0},
+		{payload{Channel: channelRGB, Depthframe: []byte{0xff, 0xd8}, frameMeta: frameMeta{Seq: 1 << 40, Width: 640, Height: 480, Units: unitsJPEG}}, 2, 1},
+		{payload{Channel: channelIR, Depthframe: []byte{}, frameMeta: frameMeta{Units: unitsJPEG}}, 3, 1},
+	}
+	for _, tt := range tests {
+		m, err := encodeMessage(formatRaw, tt.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := m.data
+		if m.kind != websocket.BinaryMessage || len(b) != rawHeaderSize+len(tt.p.Depthframe) {
+			t.Fatalf("%s: kind %d, %d bytes", tt.p.Channel, m.kind, len(b))
+		}
+		if b[0] != tt.channel || b[1] != tt.units ||
+			binary.LittleEndian.Uint16(b[2:]) != uint16(tt.p.Width) ||
+			binary.LittleEndian.Uint16(b[4:]) != uint16(tt.p.Height) ||
+			binary.LittleEndian.Uint32(b[8:]) != uint32(len(tt.p.Depthframe)) ||
+			binary.LittleEndian.Uint32(b[12:]) != tt.p.DeviceTime ||
+			binary.LittleEndian.Uint64(b[16:]) != tt.p.Seq ||
+			int64(binary.LittleEndian.Uint64(b[24:])) != tt.p.Time ||
+			!bytes.Equal(b[rawHeaderSize:], tt.p.Depthframe) {
+			t.Errorf("%s: wrong raw message % x", tt.p.Channel, b)
+		}
+	}
+
+	// payloads without d fall back to JSON
+	m, err := encodeMessage(formatRaw, payload{Channel: channelCircles, Circles: []circle{{X: 1}}})
+	if err != nil || m.kind != websocket.TextMessage {
+		t.Errorf("circles: kind %d, %v", m.kind, err)
+	}
+}
+
+func TestRawSettings(t *testing.T) {
+	raw := formatRaw
+	s := streamSettings{Detection: true, Format: formatJSON}
+	if err := s.apply(command{Format: &raw}); err == nil {
+		t.Error("raw accepted with detection")
+	}
+	s = streamSettings{Terrain: terrainOptions{Channels: []string{"slope"}}, Format: formatJSON}
+	if err := s.apply(command{Format: &raw}); err == nil {
+		t.Error("raw accepted with channels")
+	}
+	s = streamSettings{Format: formatJSON}
+	if err := s.apply(command{Format: &raw}); err != nil || s.Format != formatRaw {
+		t.Errorf("raw refused: %v", err)
+	}
+	detection := true
+	if err := s.apply(command{Detection: &detection}); err == nil {
+		t.Error("detection accepted with raw")
+	}
+}
+
+func TestNumbered(t *testing.T) {
+	p := payload{Channel: channelDepth, Depthframe: []byte{1, 2}, frameMeta: frameMeta{Seq: 9, Width: 2, Height: 1, Units: unitsDepthArray}}
+	for _, format := range []string{formatJSON, formatMsgPack, formatCBOR} {
+		for _, n := range []uint64{1, 300, 1 << 40} {
+			m, err := encodeMessage(format, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shared := append([]byte(nil), m.data...)
+			numberedMessage, err := numbered(format, m, n)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			if !bytes.Equal(m.data, shared) {
+				t.Errorf("%s: shared message changed", format)
+			}
+			var got struct {
+				N   uint64 `json:"n" codec:"n"`
+				Seq uint64 `json:"seq" codec:"seq"`
+				Ch  string `json:"ch" codec:"ch"`
+				D   []byte `json:"d" codec:"d"`
+			}
+			switch format {
+			case formatJSON:
+				err = json.Unmarshal(numberedMessage.data, &got)
+			case formatMsgPack:
+				err = codec.NewDecoderBytes(numberedMessage.data, msgpackHandle).Decode(&got)
+			case formatCBOR:
+				err = codec.NewDecoderBytes(numberedMessage.data, cborHandle).Decode(&got)
+			}
+			if err != nil || got.N != n || got.Seq != 9 || got.Ch != channelDepth || !bytes.Equal(got.D, p.Depthframe) {
+				t.Errorf("%s: n %d decoded as %+v, %v", format, n, got, err)
+			}
+		}
+	}
+
+	m, _ := encodeMessage(formatRaw, p)
+	m, err := numbered(formatRaw, m, 65537)
+	if err != nil || binary.LittleEndian.Uint16(m.data[6:]) != 1 || binary.LittleEndian.Uint64(m.data[16:]) != 9 {
+		t.Errorf("raw: % x, %v", m.data, err)
+	}
+	// raw falls back to JSON without d
+	m, _ = encodeMessage(formatRaw, payload{Channel: channelCircles})
+	if m, err = numbered(formatRaw, m, 2); err != nil || !bytes.HasPrefix(m.data, []byte(`{"n":2,"ch":`)) {
+		t.Errorf("raw without d: %s, %v", m.data, err)
+	}
+}
+
+func TestNumberedMapSizes(t *testing.T) {
+	// maps growing past the size of their header
+	for _, format := range []string{formatMsgPack, formatCBOR} {
+		for _, size := range []int{0, 15, 23, 255, 70000} {
+			v := map[string]int{}
+			for i := 0; i < size; i++ {
+				v[strconv.Itoa(i)] = i
+			}
+			b, err := encodePayload(format, v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, err = numberedMap(format, b, 5); err != nil {
+				t.Fatalf("%s %d: %v", format, size, err)
+			}
+			got := map[string]int{}
+			h := codec.Handle(msgpackHandle)
+			if format == formatCBOR {
+				h = cborHandle
+			}
+			if err := codec.NewDecoderBytes(b, h).Decode(&got); err != nil || len(got) != size+1 || got["n"] != 5 {
+				t.Errorf("%s %d: %d keys, n %d, %v", format, size, len(got), got["n"], err)
+			}
+		}
+	}
+	if _, err := numberedMap(formatCBOR, []byte{0x83, 1, 2, 3}, 1); err == nil {
+		t.Error("CBOR array accepted")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const eventLogSize = 1000
+
+// event is something that happened on the server, like a changed detection config
+type event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// eventBus fans out events to all subscribers and keeps the latest ones so
+// clients can resume after a reconnect. Slow subscribers miss events instead
+// of blocking the publisher.
+type eventBus struct {
+	mutex       sync.Mutex
+	nextID      uint64
+	log         []event
+	subscribers map[chan event]bool
+}
+
+var events = &eventBus{subscribers: map[chan event]bool{}}
+
+func (b *eventBus) publish(kind string, data interface{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextID++
+	e := event{ID: b.nextID, Type: kind, Time: time.Now(), Data: data}
+	b.log = append(b.log, e)
+	if len(b.log) > eventLogSize {
+		b.log = b.log[len(b.log)-eventLogSize:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) subscribe() chan event {
+	_, ch := b.resume(b.lastID())
+	return ch
+}
+
+// resume subscribes and returns the logged events after lastID, so nothing
+// published in between is lost
+func (b *eventBus) resume(lastID uint64) ([]event, chan event) {
+	ch := make(chan event, 64)
+	b.mutex.Lock()
+	var missed []event
+	for _, e := range b.log {
+		if e.ID > lastID {
+			missed = append(missed, e)
+		}
+	}
+	b.subscribers[ch] = true
+	first := len(b.subscribers) == 1
+	b.mutex.Unlock()
+	// the tracker takes the bus lock while holding its own
+	if first {
+		startTracking()
+	}
+	return missed, ch
+}
+
+func (b *eventBus) unsubscribe(ch chan event) {
+	b.mutex.Lock()
+	delete(b.subscribers, ch)
+	b.mutex.Unlock()
+}
+
+func (b *eventBus) lastID() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.nextID
+}
+
+// listening reports whether anybody is subscribed
+func (b *eventBus) listening() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers) > 0
+}
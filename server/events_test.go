@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quietTracker keeps subscribers from starting the tracker on the device,
+// call the returned func when done
+func quietTracker() func() {
+	tracker.mutex.Lock()
+	running := tracker.running
+	tracker.running = true
+	tracker.mutex.Unlock()
+	return func() {
+		tracker.mutex.Lock()
+		tracker.running = running
+		tracker.mutex.Unlock()
+	}
+}
+
+func TestTrackerEvents(t *testing.T) {
+	defer quietTracker()()
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	type published struct {
+		kind string
+		ids  []int
+	}
+	tests := []struct {
+		name    string
+		circles []circle
+		want    []published
+	}{
+		{"appears", []circle{{X: 100, Y: 100, R: 20}}, []published{{"enter", []int{1}}, {"circles", []int{1}}}},
+		{"moves within its radius", []circle{{X: 110, Y: 100, R: 20}}, []published{{"circles", []int{1}}}},
+		{"stays", []circle{{X: 110, Y: 100, R: 20}}, nil},
+		{"second one nearby", []circle{{X: 108, Y: 100, R: 20}, {X: 300, Y: 300, R: 5}}, []published{{"enter", []int{2}}, {"circles", []int{1, 2}}}},
+		{"jumps away", []circle{{X: 300, Y: 301, R: 5}, {X: 500, Y: 100, R: 20}}, []published{{"enter", []int{3}}, {"leave", []int{1}}, {"circles", []int{2, 3}}}},
+		{"all gone", nil, []published{{"leave", []int{2}}, {"leave", []int{3}}, {"circles", nil}}},
+	}
+	tr := &circleTracker{}
+	for _, tt := range tests {
+		tr.update(tt.circles)
+		var got []published
+		for len(ch) > 0 {
+			e := <-ch
+			p := published{kind: e.Type}
+			switch o := e.Data.(type) {
+			case trackedCircle:
+				p.ids = []int{o.ID}
+			case []trackedCircle:
+				for _, c := range o {
+					p.ids = append(p.ids, c.ID)
+				}
+			}
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: published %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// readEvent reads one event of a Server-Sent Events stream
+func readEvent(t *testing.T, r *bufio.Reader) (id uint64, kind string, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && kind != "":
+			return id, kind, data
+		case strings.HasPrefix(line, "id: "):
+			id, _ = strconv.ParseUint(line[4:], 10, 64)
+		case strings.HasPrefix(line, "event: "):
+			kind = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			data = line[6:]
+		}
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	defer quietTracker()()
+	saved, _ := circleDetectionConfig()
+	defer setCircleDetectionConfig(saved)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/events", ServeEvents)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	calibration := `config {"dp":2,"mindist":10,"param1":75,"param2":20,"min":0,"max":0}`
+	tests := []struct {
+		name   string
+		resume func(seen uint64) (header, query string)
+		want   []string // events after the device status, type and data
+	}{
+		{"Last-Event-ID", func(seen uint64) (string, string) { return strconv.FormatUint(seen, 10), "" },
+			[]string{`enter {"id":7,"x":1,"y":2,"r":3,"z":0}`, calibration}},
+		{"lastEventId parameter", func(seen uint64) (string, string) { return "", "?lastEventId=" + strconv.FormatUint(seen+1, 10) },
+			[]string{calibration}},
+		{"types", func(seen uint64) (string, string) { return strconv.FormatUint(seen, 10), "?types=config" },
+			[]string{calibration}},
+		{"new client", func(seen uint64) (string, string) { return "", "" }, nil},
+	}
+	for _, tt := range tests {
+		// a calibration the client saw and an object and calibration it missed
+		setCircleDetectionConfig(config{Dp: 1, Mindist: 10, Param1: 75, Param2: 20})
+		seen := events.lastID()
+		events.publish("enter", trackedCircle{ID: 7, circle: circle{X: 1, Y: 2, R: 3}})
+		setCircleDetectionConfig(config{Dp: 2, Mindist: 10, Param1: 75, Param2: 20})
+
+		header, query := tt.resume(seen)
+		req, _ := http.NewRequest("GET", srv.URL+"/events"+query, nil)
+		if header != "" {
+			req.Header.Set("Last-Event-ID", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("%s: content type %q", tt.name, ct)
+		}
+		r := bufio.NewReader(resp.Body)
+		if _, kind, data := readEvent(t, r); kind != "device" || data != `{"present":false}` {
+			t.Errorf("%s: first event %s %s, want the device status", tt.name, kind, data)
+		}
+		lastID := seen
+		for _, want := range tt.want {
+			id, kind, data := readEvent(t, r)
+			if got := kind + " " + data; got != want || id <= lastID {
+				t.Errorf("%s: event %d %s, want %s after %d", tt.name, id, got, want, lastID)
+			}
+			lastID = id
+		}
+
+		// events published while connected follow the replayed ones
+		setCircleDetectionConfig(config{Dp: 3, Mindist: 10, Param1: 75, Param2: 20})
+		id, kind, data := readEvent(t, r)
+		var cfg config
+		json.Unmarshal([]byte(data), &cfg)
+		if kind != "config" || cfg.Dp != 3 || id != events.lastID() {
+			t.Errorf("%s: live event %d %s %s", tt.name, id, kind, data)
+		}
+		resp.Body.Close()
+	}
+}
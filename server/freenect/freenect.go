@@ -165,7 +165,13 @@ func (d *FreenectDevice) RawDepthFrame(format VideoFormat) (unsafe.Pointer, uint
 }
 
 func (d *FreenectDevice) RGBAFrame() *image.RGBA {
-	data, _ := d.RawRGBFrame(FREENECT_VIDEO_RGB)
+	img, _ := d.RGBAFrameWithTimestamp()
+	return img
+}
+
+// RGBAFrameWithTimestamp returns the RGB frame and its device timestamp
+func (d *FreenectDevice) RGBAFrameWithTimestamp() (*image.RGBA, uint32) {
+	data, timestamp := d.RawRGBFrame(FREENECT_VIDEO_RGB)
 
 	r := image.Rect(0, 0, 640, 480)
 	img := image.NewRGBA(r)
@@ -184,11 +190,17 @@ func (d *FreenectDevice) RGBAFrame() *image.RGBA {
 
 	img.Stride = 640 * 4
 
-	return img
+	return img, timestamp
 }
 
 func (d *FreenectDevice) IRFrame() *image.RGBA {
-	data, _ := d.RawRGBFrame(FREENECT_VIDEO_IR_8BIT)
+	img, _ := d.IRFrameWithTimestamp()
+	return img
+}
+
+// IRFrameWithTimestamp returns the IR frame and its device timestamp
+func (d *FreenectDevice) IRFrameWithTimestamp() (*image.RGBA, uint32) {
+	data, timestamp := d.RawRGBFrame(FREENECT_VIDEO_IR_8BIT)
 
 	r := image.Rect(0, 0, 640, 480)
 	img := image.NewRGBA(r)
@@ -208,7 +220,7 @@ func (d *FreenectDevice) IRFrame() *image.RGBA {
 
 	img.Stride = 640 * 4
 
-	return img
+	return img, timestamp
 }
 
 func (d *FreenectDevice) DepthFrame11Bit() *image.RGBA {
@@ -236,8 +248,13 @@ func (d *FreenectDevice) DepthFrame11Bit() *image.RGBA {
 }
 
 func (d *FreenectDevice) DepthFrame() *image.RGBA {
+	img, _ := d.DepthFrameWithTimestamp()
+	return img
+}
 
-	data, _ := d.RawDepthFrame(FREENECT_DEPTH_REGISTERED)
+// DepthFrameWithTimestamp returns the depth frame image and its device timestamp
+func (d *FreenectDevice) DepthFrameWithTimestamp() (*image.RGBA, uint32) {
+	data, timestamp := d.RawDepthFrame(FREENECT_DEPTH_REGISTERED)
 
 	r := image.Rect(0, 0, 640, 480)
 	img := image.NewRGBA(r)
@@ -256,11 +273,17 @@ func (d *FreenectDevice) DepthFrame() *image.RGBA {
 
 	img.Stride = 640 * 4
 
-	return img
+	return img, timestamp
 }
 
 func (d *FreenectDevice) DepthArray(lesszero bool) []byte {
-	data, _ := d.RawDepthFrame(FREENECT_DEPTH_REGISTERED)
+	result, _ := d.DepthArrayWithTimestamp(lesszero)
+	return result
+}
+
+// DepthArrayWithTimestamp returns DepthArray and the frame's device timestamp
+func (d *FreenectDevice) DepthArrayWithTimestamp(lesszero bool) ([]byte, uint32) {
+	data, timestamp := d.RawDepthFrame(FREENECT_DEPTH_REGISTERED)
 
 	result := make([]byte, 640*480)
 	i := 0
@@ -278,9 +301,40 @@ func (d *FreenectDevice) DepthArray(lesszero bool) []byte {
 		}
 	}
 
+	return result, timestamp
+}
+
+// DepthArray16 returns the registered depth frame in millimetres.
+// Invalid pixels are 0 unless lesszero is set, in which case they are
+// filled with the previous valid value like DepthArray does.
+func (d *FreenectDevice) DepthArray16(lesszero bool) []uint16 {
+	result, _ := d.DepthArray16WithTimestamp(lesszero)
 	return result
 }
 
+// DepthArray16WithTimestamp returns DepthArray16 and the frame's device timestamp
+func (d *FreenectDevice) DepthArray16WithTimestamp(lesszero bool) ([]uint16, uint32) {
+	data, timestamp := d.RawDepthFrame(FREENECT_DEPTH_REGISTERED)
+
+	result := make([]uint16, 640*480)
+	i := 0
+	before := uint16(0)
+	for row := 0; row < 480; row++ {
+		for col := 0; col < 640; col++ {
+			sourcePos := C.int(row*640 + col)
+			val := uint16(C.get_byte_16(data, sourcePos))
+			if val == 0 && lesszero {
+				val = before
+			}
+			result[i] = val
+			before = val
+			i++
+		}
+	}
+
+	return result, timestamp
+}
+
 func (d *FreenectDevice) GetTiltDegs(ts TiltState) float32 {
 	c_ts := ConvertGoTiltStructToC(ts)
 	return float32(C.freenect_get_tilt_degs(c_ts))
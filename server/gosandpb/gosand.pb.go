@@ -0,0 +1,976 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v3.17.3
+// source: gosand.proto
+
+package gosandpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FrameType int32
+
+const (
+	FrameType_DEPTH       FrameType = 0 // depth in mm, see DepthFrame
+	FrameType_RGB         FrameType = 1 // colour camera as JPEG
+	FrameType_IR          FrameType = 2 // infrared camera as JPEG
+	FrameType_DEPTH_IMAGE FrameType = 3 // 8-bit depth image as JPEG
+)
+
+// Enum value maps for FrameType.
+var (
+	FrameType_name = map[int32]string{
+		0: "DEPTH",
+		1: "RGB",
+		2: "IR",
+		3: "DEPTH_IMAGE",
+	}
+	FrameType_value = map[string]int32{
+		"DEPTH":       0,
+		"RGB":         1,
+		"IR":          2,
+		"DEPTH_IMAGE": 3,
+	}
+)
+
+func (x FrameType) Enum() *FrameType {
+	p := new(FrameType)
+	*p = x
+	return p
+}
+
+func (x FrameType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FrameType) Descriptor() protoreflect.EnumDescriptor {
+	return file_gosand_proto_enumTypes[0].Descriptor()
+}
+
+func (FrameType) Type() protoreflect.EnumType {
+	return &file_gosand_proto_enumTypes[0]
+}
+
+func (x FrameType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FrameType.Descriptor instead.
+func (FrameType) EnumDescriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{0}
+}
+
+type FrameRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// frame types to include, DEPTH if empty
+	Types []FrameType `protobuf:"varint,1,rep,packed,name=types,proto3,enum=gosand.FrameType" json:"types,omitempty"`
+	// detect circles
+	Detection bool `protobuf:"varint,2,opt,name=detection,proto3" json:"detection,omitempty"`
+	// JPEG quality 1-100, server quality if 0
+	Quality int32 `protobuf:"varint,3,opt,name=quality,proto3" json:"quality,omitempty"`
+}
+
+func (x *FrameRequest) Reset() {
+	*x = FrameRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FrameRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FrameRequest) ProtoMessage() {}
+
+func (x *FrameRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FrameRequest.ProtoReflect.Descriptor instead.
+func (*FrameRequest) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FrameRequest) GetTypes() []FrameType {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *FrameRequest) GetDetection() bool {
+	if x != nil {
+		return x.Detection
+	}
+	return false
+}
+
+func (x *FrameRequest) GetQuality() int32 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Frame *FrameRequest `protobuf:"bytes,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	// ms between frames, at least 33, 0 for the maximum frame rate
+	Interval int32 `protobuf:"varint,2,opt,name=interval,proto3" json:"interval,omitempty"`
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubscribeRequest) GetFrame() *FrameRequest {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetInterval() int32 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
+}
+
+type Frame struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// hub tick, frames of clients sharing a tick have the same seq
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	// capture time in ms since the epoch
+	Time    int64       `protobuf:"varint,2,opt,name=time,proto3" json:"time,omitempty"`
+	Depth   *DepthFrame `protobuf:"bytes,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	Images  []*Image    `protobuf:"bytes,4,rep,name=images,proto3" json:"images,omitempty"`
+	Circles []*Circle   `protobuf:"bytes,5,rep,name=circles,proto3" json:"circles,omitempty"`
+}
+
+func (x *Frame) Reset() {
+	*x = Frame{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Frame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Frame) ProtoMessage() {}
+
+func (x *Frame) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Frame.ProtoReflect.Descriptor instead.
+func (*Frame) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Frame) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Frame) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *Frame) GetDepth() *DepthFrame {
+	if x != nil {
+		return x.Depth
+	}
+	return nil
+}
+
+func (x *Frame) GetImages() []*Image {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+func (x *Frame) GetCircles() []*Circle {
+	if x != nil {
+		return x.Circles
+	}
+	return nil
+}
+
+type DepthFrame struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Width  int32 `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height int32 `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	// little endian uint16 per pixel in mm row by row, 0 where invalid
+	Data []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *DepthFrame) Reset() {
+	*x = DepthFrame{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DepthFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DepthFrame) ProtoMessage() {}
+
+func (x *DepthFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DepthFrame.ProtoReflect.Descriptor instead.
+func (*DepthFrame) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DepthFrame) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *DepthFrame) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *DepthFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type Image struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type   FrameType `protobuf:"varint,1,opt,name=type,proto3,enum=gosand.FrameType" json:"type,omitempty"`
+	Width  int32     `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height int32     `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	// JPEG
+	Data []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *Image) Reset() {
+	*x = Image{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Image) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Image) ProtoMessage() {}
+
+func (x *Image) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Image.ProtoReflect.Descriptor instead.
+func (*Image) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Image) GetType() FrameType {
+	if x != nil {
+		return x.Type
+	}
+	return FrameType_DEPTH
+}
+
+func (x *Image) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Image) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Image) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type Circle struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	X int32 `protobuf:"varint,1,opt,name=x,proto3" json:"x,omitempty"`
+	Y int32 `protobuf:"varint,2,opt,name=y,proto3" json:"y,omitempty"`
+	R int32 `protobuf:"varint,3,opt,name=r,proto3" json:"r,omitempty"`
+	// depth at the centre from the 8-bit depth array
+	Z int32 `protobuf:"varint,4,opt,name=z,proto3" json:"z,omitempty"`
+}
+
+func (x *Circle) Reset() {
+	*x = Circle{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Circle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Circle) ProtoMessage() {}
+
+func (x *Circle) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Circle.ProtoReflect.Descriptor instead.
+func (*Circle) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Circle) GetX() int32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Circle) GetY() int32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Circle) GetR() int32 {
+	if x != nil {
+		return x.R
+	}
+	return 0
+}
+
+func (x *Circle) GetZ() int32 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+// DetectionConfig holds the OpenCV HoughCircles parameters of POST /config/
+type DetectionConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Dp      float64 `protobuf:"fixed64,1,opt,name=dp,proto3" json:"dp,omitempty"`
+	Mindist float64 `protobuf:"fixed64,2,opt,name=mindist,proto3" json:"mindist,omitempty"`
+	Param1  float64 `protobuf:"fixed64,3,opt,name=param1,proto3" json:"param1,omitempty"`
+	Param2  float64 `protobuf:"fixed64,4,opt,name=param2,proto3" json:"param2,omitempty"`
+	Min     int32   `protobuf:"varint,5,opt,name=min,proto3" json:"min,omitempty"`
+	Max     int32   `protobuf:"varint,6,opt,name=max,proto3" json:"max,omitempty"`
+}
+
+func (x *DetectionConfig) Reset() {
+	*x = DetectionConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DetectionConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DetectionConfig) ProtoMessage() {}
+
+func (x *DetectionConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DetectionConfig.ProtoReflect.Descriptor instead.
+func (*DetectionConfig) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DetectionConfig) GetDp() float64 {
+	if x != nil {
+		return x.Dp
+	}
+	return 0
+}
+
+func (x *DetectionConfig) GetMindist() float64 {
+	if x != nil {
+		return x.Mindist
+	}
+	return 0
+}
+
+func (x *DetectionConfig) GetParam1() float64 {
+	if x != nil {
+		return x.Param1
+	}
+	return 0
+}
+
+func (x *DetectionConfig) GetParam2() float64 {
+	if x != nil {
+		return x.Param2
+	}
+	return 0
+}
+
+func (x *DetectionConfig) GetMin() int32 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *DetectionConfig) GetMax() int32 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+type TiltRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// degrees, -30 to 30
+	Degrees int32 `protobuf:"varint,1,opt,name=degrees,proto3" json:"degrees,omitempty"`
+}
+
+func (x *TiltRequest) Reset() {
+	*x = TiltRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TiltRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TiltRequest) ProtoMessage() {}
+
+func (x *TiltRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TiltRequest.ProtoReflect.Descriptor instead.
+func (*TiltRequest) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TiltRequest) GetDegrees() int32 {
+	if x != nil {
+		return x.Degrees
+	}
+	return 0
+}
+
+type TiltState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Degrees float64 `protobuf:"fixed64,1,opt,name=degrees,proto3" json:"degrees,omitempty"`
+	// 0 stopped, 1 at limit, 4 moving
+	Status         int32 `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	AccelerometerX int32 `protobuf:"varint,3,opt,name=accelerometer_x,json=accelerometerX,proto3" json:"accelerometer_x,omitempty"`
+	AccelerometerY int32 `protobuf:"varint,4,opt,name=accelerometer_y,json=accelerometerY,proto3" json:"accelerometer_y,omitempty"`
+	AccelerometerZ int32 `protobuf:"varint,5,opt,name=accelerometer_z,json=accelerometerZ,proto3" json:"accelerometer_z,omitempty"`
+}
+
+func (x *TiltState) Reset() {
+	*x = TiltState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_gosand_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TiltState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TiltState) ProtoMessage() {}
+
+func (x *TiltState) ProtoReflect() protoreflect.Message {
+	mi := &file_gosand_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TiltState.ProtoReflect.Descriptor instead.
+func (*TiltState) Descriptor() ([]byte, []int) {
+	return file_gosand_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TiltState) GetDegrees() float64 {
+	if x != nil {
+		return x.Degrees
+	}
+	return 0
+}
+
+func (x *TiltState) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *TiltState) GetAccelerometerX() int32 {
+	if x != nil {
+		return x.AccelerometerX
+	}
+	return 0
+}
+
+func (x *TiltState) GetAccelerometerY() int32 {
+	if x != nil {
+		return x.AccelerometerY
+	}
+	return 0
+}
+
+func (x *TiltState) GetAccelerometerZ() int32 {
+	if x != nil {
+		return x.AccelerometerZ
+	}
+	return 0
+}
+
+var File_gosand_proto protoreflect.FileDescriptor
+
+var file_gosand_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06,
+	0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x22, 0x6f, 0x0a, 0x0c, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x27, 0x0a, 0x05, 0x74, 0x79, 0x70, 0x65, 0x73, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x46,
+	0x72, 0x61, 0x6d, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x05, 0x74, 0x79, 0x70, 0x65, 0x73, 0x12,
+	0x1c, 0x0a, 0x09, 0x64, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x09, 0x64, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a,
+	0x07, 0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07,
+	0x71, 0x75, 0x61, 0x6c, 0x69, 0x74, 0x79, 0x22, 0x5a, 0x0a, 0x10, 0x53, 0x75, 0x62, 0x73, 0x63,
+	0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2a, 0x0a, 0x05, 0x66,
+	0x72, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x73,
+	0x61, 0x6e, 0x64, 0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x52, 0x05, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x76, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x76, 0x61, 0x6c, 0x22, 0xa8, 0x01, 0x0a, 0x05, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x10, 0x0a,
+	0x03, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12,
+	0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x74,
+	0x69, 0x6d, 0x65, 0x12, 0x28, 0x0a, 0x05, 0x64, 0x65, 0x70, 0x74, 0x68, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x44, 0x65, 0x70, 0x74,
+	0x68, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52, 0x05, 0x64, 0x65, 0x70, 0x74, 0x68, 0x12, 0x25, 0x0a,
+	0x06, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e,
+	0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x06, 0x69, 0x6d,
+	0x61, 0x67, 0x65, 0x73, 0x12, 0x28, 0x0a, 0x07, 0x63, 0x69, 0x72, 0x63, 0x6c, 0x65, 0x73, 0x18,
+	0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x43,
+	0x69, 0x72, 0x63, 0x6c, 0x65, 0x52, 0x07, 0x63, 0x69, 0x72, 0x63, 0x6c, 0x65, 0x73, 0x22, 0x4e,
+	0x0a, 0x0a, 0x44, 0x65, 0x70, 0x74, 0x68, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x77, 0x69, 0x64,
+	0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61,
+	0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x70,
+	0x0a, 0x05, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x25, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x46,
+	0x72, 0x61, 0x6d, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x77,
+	0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x12, 0x0a, 0x04,
+	0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61,
+	0x22, 0x40, 0x0a, 0x06, 0x43, 0x69, 0x72, 0x63, 0x6c, 0x65, 0x12, 0x0c, 0x0a, 0x01, 0x78, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x01, 0x78, 0x12, 0x0c, 0x0a, 0x01, 0x79, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x01, 0x79, 0x12, 0x0c, 0x0a, 0x01, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x01, 0x72, 0x12, 0x0c, 0x0a, 0x01, 0x7a, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x01, 0x7a, 0x22, 0x8f, 0x01, 0x0a, 0x0f, 0x44, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x0e, 0x0a, 0x02, 0x64, 0x70, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x02, 0x64, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x64, 0x69, 0x73,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x6d, 0x69, 0x6e, 0x64, 0x69, 0x73, 0x74,
+	0x12, 0x16, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x31, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x31, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61,
+	0x6d, 0x32, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x32,
+	0x12, 0x10, 0x0a, 0x03, 0x6d, 0x69, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x6d,
+	0x69, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x61, 0x78, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x03, 0x6d, 0x61, 0x78, 0x22, 0x27, 0x0a, 0x0b, 0x54, 0x69, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x65, 0x67, 0x72, 0x65, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x64, 0x65, 0x67, 0x72, 0x65, 0x65, 0x73, 0x22, 0xb8, 0x01,
+	0x0a, 0x09, 0x54, 0x69, 0x6c, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x64,
+	0x65, 0x67, 0x72, 0x65, 0x65, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x64, 0x65,
+	0x67, 0x72, 0x65, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x27, 0x0a,
+	0x0f, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65, 0x72, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x5f, 0x78,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65, 0x72, 0x6f,
+	0x6d, 0x65, 0x74, 0x65, 0x72, 0x58, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65,
+	0x72, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x5f, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x0e, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65, 0x72, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x59, 0x12,
+	0x27, 0x0a, 0x0f, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65, 0x72, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72,
+	0x5f, 0x7a, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x61, 0x63, 0x63, 0x65, 0x6c, 0x65,
+	0x72, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x5a, 0x2a, 0x38, 0x0a, 0x09, 0x46, 0x72, 0x61, 0x6d,
+	0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x09, 0x0a, 0x05, 0x44, 0x45, 0x50, 0x54, 0x48, 0x10, 0x00,
+	0x12, 0x07, 0x0a, 0x03, 0x52, 0x47, 0x42, 0x10, 0x01, 0x12, 0x06, 0x0a, 0x02, 0x49, 0x52, 0x10,
+	0x02, 0x12, 0x0f, 0x0a, 0x0b, 0x44, 0x45, 0x50, 0x54, 0x48, 0x5f, 0x49, 0x4d, 0x41, 0x47, 0x45,
+	0x10, 0x03, 0x32, 0xec, 0x01, 0x0a, 0x06, 0x47, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x12, 0x36, 0x0a,
+	0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x18, 0x2e, 0x67, 0x6f, 0x73,
+	0x61, 0x6e, 0x64, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x46, 0x72,
+	0x61, 0x6d, 0x65, 0x30, 0x01, 0x12, 0x2f, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x46, 0x72, 0x61, 0x6d,
+	0x65, 0x12, 0x14, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64,
+	0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x46, 0x0a, 0x12, 0x53, 0x65, 0x74, 0x44, 0x65, 0x74,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x17, 0x2e, 0x67,
+	0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x44, 0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x1a, 0x17, 0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x44,
+	0x65, 0x74, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x31,
+	0x0a, 0x07, 0x53, 0x65, 0x74, 0x54, 0x69, 0x6c, 0x74, 0x12, 0x13, 0x2e, 0x67, 0x6f, 0x73, 0x61,
+	0x6e, 0x64, 0x2e, 0x54, 0x69, 0x6c, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11,
+	0x2e, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2e, 0x54, 0x69, 0x6c, 0x74, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f,
+	0x6d, 0x6f, 0x65, 0x74, 0x68, 0x75, 0x2f, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x2f, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x2f, 0x67, 0x6f, 0x73, 0x61, 0x6e, 0x64, 0x70, 0x62, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_gosand_proto_rawDescOnce sync.Once
+	file_gosand_proto_rawDescData = file_gosand_proto_rawDesc
+)
+
+func file_gosand_proto_rawDescGZIP() []byte {
+	file_gosand_proto_rawDescOnce.Do(func() {
+		file_gosand_proto_rawDescData = protoimpl.X.CompressGZIP(file_gosand_proto_rawDescData)
+	})
+	return file_gosand_proto_rawDescData
+}
+
+var file_gosand_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_gosand_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_gosand_proto_goTypes = []interface{}{
+	(FrameType)(0),           // 0: gosand.FrameType
+	(*FrameRequest)(nil),     // 1: gosand.FrameRequest
+	(*SubscribeRequest)(nil), // 2: gosand.SubscribeRequest
+	(*Frame)(nil),            // 3: gosand.Frame
+	(*DepthFrame)(nil),       // 4: gosand.DepthFrame
+	(*Image)(nil),            // 5: gosand.Image
+	(*Circle)(nil),           // 6: gosand.Circle
+	(*DetectionConfig)(nil),  // 7: gosand.DetectionConfig
+	(*TiltRequest)(nil),      // 8: gosand.TiltRequest
+	(*TiltState)(nil),        // 9: gosand.TiltState
+}
+var file_gosand_proto_depIdxs = []int32{
+	0,  // 0: gosand.FrameRequest.types:type_name -> gosand.FrameType
+	1,  // 1: gosand.SubscribeRequest.frame:type_name -> gosand.FrameRequest
+	4,  // 2: gosand.Frame.depth:type_name -> gosand.DepthFrame
+	5,  // 3: gosand.Frame.images:type_name -> gosand.Image
+	6,  // 4: gosand.Frame.circles:type_name -> gosand.Circle
+	0,  // 5: gosand.Image.type:type_name -> gosand.FrameType
+	2,  // 6: gosand.Gosand.Subscribe:input_type -> gosand.SubscribeRequest
+	1,  // 7: gosand.Gosand.GetFrame:input_type -> gosand.FrameRequest
+	7,  // 8: gosand.Gosand.SetDetectionConfig:input_type -> gosand.DetectionConfig
+	8,  // 9: gosand.Gosand.SetTilt:input_type -> gosand.TiltRequest
+	3,  // 10: gosand.Gosand.Subscribe:output_type -> gosand.Frame
+	3,  // 11: gosand.Gosand.GetFrame:output_type -> gosand.Frame
+	7,  // 12: gosand.Gosand.SetDetectionConfig:output_type -> gosand.DetectionConfig
+	9,  // 13: gosand.Gosand.SetTilt:output_type -> gosand.TiltState
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_gosand_proto_init() }
+func file_gosand_proto_init() {
+	if File_gosand_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_gosand_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FrameRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Frame); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DepthFrame); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Image); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Circle); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DetectionConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TiltRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_gosand_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TiltState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_gosand_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gosand_proto_goTypes,
+		DependencyIndexes: file_gosand_proto_depIdxs,
+		EnumInfos:         file_gosand_proto_enumTypes,
+		MessageInfos:      file_gosand_proto_msgTypes,
+	}.Build()
+	File_gosand_proto = out.File
+	file_gosand_proto_rawDesc = nil
+	file_gosand_proto_goTypes = nil
+	file_gosand_proto_depIdxs = nil
+}
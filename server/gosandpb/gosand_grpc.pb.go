@@ -0,0 +1,245 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package gosandpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GosandClient is the client API for Gosand service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GosandClient interface {
+	// Subscribe streams frames at the requested interval until the client cancels.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Gosand_SubscribeClient, error)
+	// GetFrame returns a single frame.
+	GetFrame(ctx context.Context, in *FrameRequest, opts ...grpc.CallOption) (*Frame, error)
+	// SetDetectionConfig replaces the circle detection config and returns it.
+	SetDetectionConfig(ctx context.Context, in *DetectionConfig, opts ...grpc.CallOption) (*DetectionConfig, error)
+	// SetTilt moves the camera and returns its tilt state.
+	SetTilt(ctx context.Context, in *TiltRequest, opts ...grpc.CallOption) (*TiltState, error)
+}
+
+type gosandClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGosandClient(cc grpc.ClientConnInterface) GosandClient {
+	return &gosandClient{cc}
+}
+
+func (c *gosandClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Gosand_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gosand_ServiceDesc.Streams[0], "/gosand.Gosand/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gosandSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gosand_SubscribeClient interface {
+	Recv() (*Frame, error)
+	grpc.ClientStream
+}
+
+type gosandSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *gosandSubscribeClient) Recv() (*Frame, error) {
+	m := new(Frame)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *gosandClient) GetFrame(ctx context.Context, in *FrameRequest, opts ...grpc.CallOption) (*Frame, error) {
+	out := new(Frame)
+	err := c.cc.Invoke(ctx, "/gosand.Gosand/GetFrame", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gosandClient) SetDetectionConfig(ctx context.Context, in *DetectionConfig, opts ...grpc.CallOption) (*DetectionConfig, error) {
+	out := new(DetectionConfig)
+	err := c.cc.Invoke(ctx, "/gosand.Gosand/SetDetectionConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gosandClient) SetTilt(ctx context.Context, in *TiltRequest, opts ...grpc.CallOption) (*TiltState, error) {
+	out := new(TiltState)
+	err := c.cc.Invoke(ctx, "/gosand.Gosand/SetTilt", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GosandServer is the server API for Gosand service.
+// All implementations must embed UnimplementedGosandServer
+// for forward compatibility
+type GosandServer interface {
+	// Subscribe streams frames at the requested interval until the client cancels.
+	Subscribe(*SubscribeRequest, Gosand_SubscribeServer) error
+	// GetFrame returns a single frame.
+	GetFrame(context.Context, *FrameRequest) (*Frame, error)
+	// SetDetectionConfig replaces the circle detection config and returns it.
+	SetDetectionConfig(context.Context, *DetectionConfig) (*DetectionConfig, error)
+	// SetTilt moves the camera and returns its tilt state.
+	SetTilt(context.Context, *TiltRequest) (*TiltState, error)
+	mustEmbedUnimplementedGosandServer()
+}
+
+// UnimplementedGosandServer must be embedded to have forward compatible implementations.
+type UnimplementedGosandServer struct {
+}
+
+func (UnimplementedGosandServer) Subscribe(*SubscribeRequest, Gosand_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedGosandServer) GetFrame(context.Context, *FrameRequest) (*Frame, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFrame not implemented")
+}
+func (UnimplementedGosandServer) SetDetectionConfig(context.Context, *DetectionConfig) (*DetectionConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetDetectionConfig not implemented")
+}
+func (UnimplementedGosandServer) SetTilt(context.Context, *TiltRequest) (*TiltState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetTilt not implemented")
+}
+func (UnimplementedGosandServer) mustEmbedUnimplementedGosandServer() {}
+
+// UnsafeGosandServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GosandServer will
+// result in compilation errors.
+type UnsafeGosandServer interface {
+	mustEmbedUnimplementedGosandServer()
+}
+
+func RegisterGosandServer(s grpc.ServiceRegistrar, srv GosandServer) {
+	s.RegisterService(&Gosand_ServiceDesc, srv)
+}
+
+func _Gosand_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GosandServer).Subscribe(m, &gosandSubscribeServer{stream})
+}
+
+type Gosand_SubscribeServer interface {
+	Send(*Frame) error
+	grpc.ServerStream
+}
+
+type gosandSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *gosandSubscribeServer) Send(m *Frame) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Gosand_GetFrame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FrameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GosandServer).GetFrame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gosand.Gosand/GetFrame",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GosandServer).GetFrame(ctx, req.(*FrameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gosand_SetDetectionConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DetectionConfig)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GosandServer).SetDetectionConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gosand.Gosand/SetDetectionConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GosandServer).SetDetectionConfig(ctx, req.(*DetectionConfig))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gosand_SetTilt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TiltRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GosandServer).SetTilt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gosand.Gosand/SetTilt",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GosandServer).SetTilt(ctx, req.(*TiltRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Gosand_ServiceDesc is the grpc.ServiceDesc for Gosand service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gosand_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gosand.Gosand",
+	HandlerType: (*GosandServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetFrame",
+			Handler:    _Gosand_GetFrame_Handler,
+		},
+		{
+			MethodName: "SetDetectionConfig",
+			Handler:    _Gosand_SetDetectionConfig_Handler,
+		},
+		{
+			MethodName: "SetTilt",
+			Handler:    _Gosand_SetTilt_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Gosand_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gosand.proto",
+}
@@ -0,0 +1,208 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative -I gosandpb gosandpb/gosand.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"log"
+	"net"
+	"time"
+
+	"github.com/moethu/gosand/server/gosandpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcImages maps frame types sent as JPEG to the hub's image types
+var grpcImages = map[gosandpb.FrameType]string{
+	gosandpb.FrameType_RGB:         "rgb",
+	gosandpb.FrameType_IR:          "ir",
+	gosandpb.FrameType_DEPTH_IMAGE: "depth",
+}
+
+var errShuttingDown = status.Error(codes.Unavailable, "server shutting down")
+
+// grpcServer serves the gosand.Gosand service defined in gosandpb/gosand.proto
+type grpcServer struct {
+	gosandpb.UnimplementedGosandServer
+}
+
+// startGRPC serves the gRPC service on addr next to the HTTP server
+func startGRPC(addr string) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := grpc.NewServer()
+	gosandpb.RegisterGosandServer(srv, &grpcServer{})
+	log.Println("Starting gRPC Server on Port", addr)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.Println("gRPC:", err)
+		}
+	}()
+	return srv, nil
+}
+
+// grpcFrame builds a frame from a hub frame, JPEGs are shared with other
+// subscribers asking for the same type and quality
+func grpcFrame(f *hubFrame, req *gosandpb.FrameRequest) (*gosandpb.Frame, error) {
+	quality := int(req.GetQuality())
+	if quality < 1 || quality > 100 {
+		quality = image_quality
+	}
+	types := req.GetTypes()
+	if len(types) == 0 {
+		types = []gosandpb.FrameType{gosandpb.FrameType_DEPTH}
+	}
+
+	frame := &gosandpb.Frame{Seq: f.seq, Time: f.taken.UnixNano() / int64(time.Millisecond)}
+	for _, t := range types {
+		if t == gosandpb.FrameType_DEPTH {
+			depth := f.depthArray16()
+			data := make([]byte, 2*len(depth))
+			for i, d := range depth {
+				binary.LittleEndian.PutUint16(data[2*i:], d)
+			}
+			frame.Depth = &gosandpb.DepthFrame{Width: frameWidth, Height: frameHeight, Data: data}
+			continue
+		}
+		name, ok := grpcImages[t]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown frame type %v", t)
+		}
+		key := fmt.Sprintf("grpc/%s/%d", name, quality)
+		m, err := f.message(key, func() (message, error) {
+			var buf bytes.Buffer
+			err := jpeg.Encode(&buf, f.image(name), &jpeg.Options{Quality: quality})
+			return message{data: buf.Bytes()}, err
+		})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		bounds := f.image(name).Bounds()
+		frame.Images = append(frame.Images, &gosandpb.Image{
+			Type:   t,
+			Width:  int32(bounds.Dx()),
+			Height: int32(bounds.Dy()),
+			Data:   m.data,
+		})
+	}
+	if req.GetDetection() {
+		for _, c := range f.detect() {
+			frame.Circles = append(frame.Circles, &gosandpb.Circle{X: int32(c.X), Y: int32(c.Y), R: int32(c.R), Z: int32(c.Z)})
+		}
+	}
+	return frame, nil
+}
+
+// grpcPeerIP is the address a gRPC client connected from
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// Subscribe streams frames from the hub until the client cancels
+func (s *grpcServer) Subscribe(req *gosandpb.SubscribeRequest, stream gosandpb.Gosand_SubscribeServer) error {
+	interval := int(req.GetInterval())
+	if interval == 0 {
+		interval = 1000 / maxFPS
+	}
+	if err := validInterval(interval); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	client := newEndpointClient(kindGRPC)
+	id, err := streamClients.add(grpcPeerIP(stream.Context()), client)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer streamClients.remove(id)
+	if !deviceUsers.enter() {
+		return errShuttingDown
+	}
+	defer deviceUsers.leave()
+	ticks := make(chan *hubFrame, 1)
+	defer streamHub.unsubscribe(ticks)
+	streamHub.subscribe(ticks, time.Duration(interval)*time.Millisecond)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-serverContext.Done():
+			return errShuttingDown
+		case <-client.done:
+			return status.Error(codes.Aborted, "disconnected by admin")
+		case f := <-ticks:
+			frame, err := grpcFrame(f, req.GetFrame())
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetFrame captures a single frame
+func (s *grpcServer) GetFrame(ctx context.Context, req *gosandpb.FrameRequest) (*gosandpb.Frame, error) {
+	if !deviceUsers.enter() {
+		return nil, errShuttingDown
+	}
+	defer deviceUsers.leave()
+	return grpcFrame(newHubFrame(), req)
+}
+
+// SetDetectionConfig replaces the circle detection config like POST /config/,
+// an empty config selects the defaults
+func (s *grpcServer) SetDetectionConfig(ctx context.Context, req *gosandpb.DetectionConfig) (*gosandpb.DetectionConfig, error) {
+	cfg := config{
+		Dp:      req.GetDp(),
+		Mindist: req.GetMindist(),
+		Param1:  req.GetParam1(),
+		Param2:  req.GetParam2(),
+		Min:     int(req.GetMin()),
+		Max:     int(req.GetMax()),
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	setCircleDetectionConfig(cfg)
+	return req, nil
+}
+
+// SetTilt moves the camera to the requested angle
+func (s *grpcServer) SetTilt(ctx context.Context, req *gosandpb.TiltRequest) (*gosandpb.TiltState, error) {
+	if !freenect_device_present {
+		return nil, status.Error(codes.Unavailable, "no kinect device")
+	}
+	if req.GetDegrees() < -30 || req.GetDegrees() > 30 {
+		return nil, status.Errorf(codes.InvalidArgument, "tilt %d out of range -30 to 30", req.GetDegrees())
+	}
+	if !deviceUsers.enter() {
+		return nil, errShuttingDown
+	}
+	defer deviceUsers.leave()
+	freenect_device.SetTiltDegs(int(req.GetDegrees()))
+	ts := freenect_device.GetTiltState()
+	return &gosandpb.TiltState{
+		Degrees:        float64(freenect_device.GetTiltDegs(ts)),
+		Status:         int32(ts.Tilt_status),
+		AccelerometerX: int32(ts.Accelerometer_x),
+		AccelerometerY: int32(ts.Accelerometer_y),
+		AccelerometerZ: int32(ts.Accelerometer_z),
+	}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moethu/gosand/server/gosandpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeDevice replaces the device reads by a flat sandbox at depth mm,
+// call the returned func to restore them
+func fakeDevice(depth uint16) func() {
+	readDepth := deviceDepth16
+	deviceDepth16 = func() ([]uint16, uint32) {
+		d := make([]uint16, frameWidth*frameHeight)
+		for i := range d {
+			d[i] = depth
+		}
+		return d, 42
+	}
+	captures := map[string]func() (image.Image, uint32){}
+	for name, loop := range captureLoops {
+		captures[name] = loop.capture
+		loop.capture = func() (image.Image, uint32) {
+			img := image.NewRGBA(image.Rect(0, 0, frameWidth, frameHeight))
+			for i := range img.Pix {
+				img.Pix[i] = 0x80
+			}
+			return img, 42
+		}
+	}
+	return func() {
+		deviceDepth16 = readDepth
+		for name, capture := range captures {
+			captureLoops[name].capture = capture
+		}
+	}
+}
+
+// dialGRPC serves the gRPC service in memory and returns a client of it
+func dialGRPC(t *testing.T) (gosandpb.GosandClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	gosandpb.RegisterGosandServer(srv, &grpcServer{})
+	go srv.Serve(lis)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gosandpb.NewGosandClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+// deviceIdle waits until nobody uses the device anymore
+func deviceIdle(t *testing.T) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		deviceUsers.mutex.Lock()
+		count := deviceUsers.count
+		deviceUsers.mutex.Unlock()
+		if count == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("device still in use")
+}
+
+func TestGRPCGetFrame(t *testing.T) {
+	defer fakeDevice(1234)()
+	client, stop := dialGRPC(t)
+	defer stop()
+
+	frame, err := client.GetFrame(context.Background(), &gosandpb.FrameRequest{
+		Types: []gosandpb.FrameType{gosandpb.FrameType_DEPTH, gosandpb.FrameType_RGB},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := frame.GetDepth()
+	if frame.GetSeq() == 0 || d.GetWidth() != frameWidth || d.GetHeight() != frameHeight || len(d.GetData()) != 2*frameWidth*frameHeight {
+		t.Fatalf("seq %d, depth %dx%d with %d bytes", frame.GetSeq(), d.GetWidth(), d.GetHeight(), len(d.GetData()))
+	}
+	if v := binary.LittleEndian.Uint16(d.GetData()[2*1000:]); v != 1234 {
+		t.Errorf("depth %d mm, want 1234", v)
+	}
+	if len(frame.GetImages()) != 1 {
+		t.Fatalf("%d images, want 1", len(frame.GetImages()))
+	}
+	img, err := jpeg.Decode(bytes.NewReader(frame.GetImages()[0].GetData()))
+	if err != nil || img.Bounds().Dx() != frameWidth || img.Bounds().Dy() != frameHeight {
+		t.Fatalf("rgb image %v, %v", img.Bounds(), err)
+	}
+	if r, _, _, _ := color.RGBAModel.Convert(img.At(10, 10)).RGBA(); r>>8 < 0x78 || r>>8 > 0x88 {
+		t.Errorf("rgb red %x, want about 80", r>>8)
+	}
+
+	_, err = client.GetFrame(context.Background(), &gosandpb.FrameRequest{Types: []gosandpb.FrameType{99}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown frame type: %v", err)
+	}
+	deviceIdle(t)
+}
+
+func TestGRPCSubscribe(t *testing.T) {
+	defer fakeDevice(1000)()
+	client, stop := dialGRPC(t)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Subscribe(ctx, &gosandpb.SubscribeRequest{Interval: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seq uint64
+	for i := 0; i < 3; i++ {
+		frame, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetSeq() <= seq || len(frame.GetDepth().GetData()) != 2*frameWidth*frameHeight {
+			t.Fatalf("frame %d after %d with %d depth bytes", frame.GetSeq(), seq, len(frame.GetDepth().GetData()))
+		}
+		seq = frame.GetSeq()
+	}
+
+	// cancelling ends the stream on both sides
+	cancel()
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("after cancel: %v", err)
+	}
+	deviceIdle(t)
+
+	stream, err = client.Subscribe(context.Background(), &gosandpb.SubscribeRequest{Interval: 1})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("interval below min_interval: %v", err)
+	}
+}
+
+func TestGRPCSetDetectionConfig(t *testing.T) {
+	saved, _ := circleDetectionConfig()
+	defer setCircleDetectionConfig(saved)
+	client, stop := dialGRPC(t)
+	defer stop()
+
+	want := config{Dp: 1, Mindist: 20, Param1: 75, Param2: 20, Min: 4, Max: 40}
+	_, err := client.SetDetectionConfig(context.Background(), &gosandpb.DetectionConfig{Dp: 1, Mindist: 20, Param1: 75, Param2: 20, Min: 4, Max: 40})
+	if cfg, _ := circleDetectionConfig(); err != nil || cfg != want {
+		t.Errorf("config %+v, %v", cfg, err)
+	}
+	_, err = client.SetDetectionConfig(context.Background(), &gosandpb.DetectionConfig{Dp: 1, Mindist: 20, Param1: 75, Param2: 20, Min: 40, Max: 4})
+	if cfg, _ := circleDetectionConfig(); status.Code(err) != codes.InvalidArgument || cfg != want {
+		t.Errorf("max below min: config %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	frameWidth  = 640
+	frameHeight = 480
+)
+
+// heightfield is a regular grid of sand heights in millimetres above a
+// baseline distance from the camera. Invalid pixels are NaN.
+type heightfield struct {
+	Width  int
+	Height int
+	Z      []float64
+}
+
+// newHeightfield converts a millimetre depth frame into heights relative to base.
+// A base of 0 uses the farthest valid depth of the frame, so the lowest sand
+// point ends up at height 0.
+func newHeightfield(depth []uint16, base float64) heightfield {
+	if base <= 0 {
+		for _, d := range depth {
+			if float64(d) > base {
+				base = float64(d)
+			}
+		}
+	}
+	h := heightfield{Width: frameWidth, Height: frameHeight, Z: make([]float64, len(depth))}
+	for i, d := range depth {
+		if d == 0 {
+			h.Z[i] = math.NaN()
+			continue
+		}
+		h.Z[i] = base - float64(d)
+	}
+	return h
+}
+
+// captureHeightfield reads the current depth frame and applies the base
+// query parameter (distance camera to baseline in mm).
+func captureHeightfield(c *gin.Context) heightfield {
+	depth := freenect_device.DepthArray16(false)
+	return newHeightfield(depth, queryFloat(c, "base", 0))
+}
+
+// terrainOptions select heightfield based data sent along with the depth array
+type terrainOptions struct {
+	Base     float64 // distance camera to baseline in mm
+	CellSize float64 // pixel size on the sand in mm
+	Contours contourOptions
+	Channels []string // derivatives sent as float32 channels
+}
+
+func terrainOptionsFromQuery(c *gin.Context) (terrainOptions, error) {
+	contours, err := contourOptionsFromQuery(c)
+	o := terrainOptions{
+		Base:     queryFloat(c, "base", 0),
+		CellSize: queryFloat(c, "cellsize", 1.7),
+		Contours: contours,
+	}
+	for _, name := range strings.Split(c.Request.URL.Query().Get("channels"), ",") {
+		for _, d := range derivatives {
+			if name == d {
+				o.Channels = append(o.Channels, name)
+			}
+		}
+	}
+	return o, err
+}
+
+// enabled reports whether any terrain data is requested
+func (o terrainOptions) enabled() bool {
+	return o.Contours.Interval > 0 || len(o.Channels) > 0
+}
+
+// apply captures a heightfield and adds contours and channels to the payload if enabled
+func (o terrainOptions) apply(p *payload) {
+	if !o.enabled() {
+		return
+	}
+	o.applyDepth(p, freenect_device.DepthArray16(false))
+}
+
+// applyDepth adds contours and channels of a captured millimetre depth frame to the payload if enabled
+func (o terrainOptions) applyDepth(p *payload, depth []uint16) {
+	if !o.enabled() {
+		return
+	}
+	h := newHeightfield(depth, o.Base)
+	p.Contours = contours(h, o.Contours.Interval, o.Contours.Start)
+	p.Channels = derivativeChannels(h, o.Channels, o.CellSize)
+}
+
+// At returns the height at column x and row y.
+func (h heightfield) At(x, y int) float64 {
+	return h.Z[y*h.Width+x]
+}
+
+// Valid reports whether the height at column x and row y has been measured.
+func (h heightfield) Valid(x, y int) bool {
+	return !math.IsNaN(h.Z[y*h.Width+x])
+}
+
+// Range returns the lowest and highest valid height.
+func (h heightfield) Range() (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, z := range h.Z {
+		if math.IsNaN(z) {
+			continue
+		}
+		min = math.Min(min, z)
+		max = math.Max(max, z)
+	}
+	if math.IsInf(min, 1) {
+		return 0, 0
+	}
+	return min, max
+}
+
+// Filled returns a copy where invalid pixels are replaced by the lowest valid height.
+func (h heightfield) Filled() heightfield {
+	min, _ := h.Range()
+	f := heightfield{Width: h.Width, Height: h.Height, Z: make([]float64, len(h.Z))}
+	for i, z := range h.Z {
+		if math.IsNaN(z) {
+			z = min
+		}
+		f.Z[i] = z
+	}
+	return f
+}
+
+// Downsample returns every step-th row and column.
+func (h heightfield) Downsample(step int) heightfield {
+	if step <= 1 {
+		return h
+	}
+	w := (h.Width-1)/step + 1
+	ht := (h.Height-1)/step + 1
+	d := heightfield{Width: w, Height: ht, Z: make([]float64, w*ht)}
+	for y := 0; y < ht; y++ {
+		for x := 0; x < w; x++ {
+			d.Z[y*w+x] = h.At(x*step, y*step)
+		}
+	}
+	return d
+}
+
+// Sample interpolates the height bilinearly at fractional pixel coordinates,
+// positions outside the grid are clamped to its border
+func (h heightfield) Sample(fx, fy float64) float64 {
+	fx = math.Max(0, math.Min(float64(h.Width-1), fx))
+	fy = math.Max(0, math.Min(float64(h.Height-1), fy))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := x0+1, y0+1
+	if x1 >= h.Width {
+		x1 = x0
+	}
+	if y1 >= h.Height {
+		y1 = y0
+	}
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	top := h.At(x0, y0)*(1-tx) + h.At(x1, y0)*tx
+	bottom := h.At(x0, y1)*(1-tx) + h.At(x1, y1)*tx
+	return top*(1-ty) + bottom*ty
+}
+
+// Gradient returns the height change per map unit in x and y direction at
+// column x and row y using Horn's method. Rows grow southwards, so a positive
+// dzdy means the terrain rises towards the bottom of the image.
+// Invalid or border neighbours fall back to the center height.
+func (h heightfield) Gradient(x, y int, cellsize float64) (float64, float64) {
+	center := h.At(x, y)
+	z := func(dx, dy int) float64 {
+		nx, ny := x+dx, y+dy
+		if nx < 0 || ny < 0 || nx >= h.Width || ny >= h.Height || !h.Valid(nx, ny) {
+			return center
+		}
+		return h.At(nx, ny)
+	}
+	dzdx := ((z(1, -1) + 2*z(1, 0) + z(1, 1)) - (z(-1, -1) + 2*z(-1, 0) + z(-1, 1))) / (8 * cellsize)
+	dzdy := ((z(-1, 1) + 2*z(0, 1) + z(1, 1)) - (z(-1, -1) + 2*z(0, -1) + z(1, -1))) / (8 * cellsize)
+	return dzdx, dzdy
+}
+
+// queryFloat returns a numeric query parameter or def if missing or invalid.
+func queryFloat(c *gin.Context, name string, def float64) float64 {
+	v, err := strconv.ParseFloat(c.Request.URL.Query().Get(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// queryInt returns an integer query parameter or def if missing or invalid.
+func queryInt(c *gin.Context, name string, def int) int {
+	v, err := strconv.Atoi(c.Request.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hubFrame is one tick of the hub. Sources are captured on first use only,
+// so each of them is read from the device at most once per tick however many
+// clients need it, and encoded messages are shared by clients with the same
+// settings and format.
+type hubFrame struct {
+	seq   uint64
+	taken time.Time
+
+	depthOnce sync.Once
+	depth     []byte // 8-bit depth array, invalid pixels 0
+
+	depth16Once sync.Once
+	depth16     []uint16 // depth in mm, invalid pixels 0
+	depth16Time uint32   // device timestamp of both depth arrays
+
+	detectOnce    sync.Once
+	circles       []circle      // all circles of the frame with their depth
+	detectLatency time.Duration // from taking the frame until its circles were detected
+
+	images map[string]*hubImage
+
+	mutex    sync.Mutex
+	messages map[string]*hubMessage
+}
+
+type hubImage struct {
+	once      sync.Once
+	img       image.Image
+	timestamp uint32
+}
+
+type hubMessage struct {
+	once sync.Once
+	m    message
+	err  error
+}
+
+// frameSeq counts the frames taken by the hub and single reads like /data/
+var frameSeq uint64
+
+func nextFrameSeq() uint64 {
+	return atomic.AddUint64(&frameSeq, 1)
+}
+
+func newHubFrame() *hubFrame {
+	f := &hubFrame{seq: nextFrameSeq(), taken: time.Now(), images: map[string]*hubImage{}, messages: map[string]*hubMessage{}}
+	for name := range captureLoops {
+		f.images[name] = &hubImage{}
+	}
+	return f
+}
+
+// deviceDepth16 reads the depth in mm from the device
+var deviceDepth16 = func() ([]uint16, uint32) { return freenect_device.DepthArray16WithTimestamp(false) }
+
+// depthArray returns the 8-bit depth array, the low byte of the depth in mm
+// like the device's depth array, so both come from the same read
+func (f *hubFrame) depthArray() []byte {
+	f.depthOnce.Do(func() {
+		depth16 := f.depthArray16()
+		f.depth = make([]byte, len(depth16))
+		for i, d := range depth16 {
+			f.depth[i] = byte(d)
+		}
+	})
+	return f.depth
+}
+
+func (f *hubFrame) depthArray16() []uint16 {
+	f.depth16Once.Do(func() { f.depth16, f.depth16Time = deviceDepth16() })
+	return f.depth16
+}
+
+// detect returns the detected circles, Z is taken from the filled depth array
+func (f *hubFrame) detect() []circle {
+	f.detectOnce.Do(func() {
+		defer func() { f.detectLatency = time.Since(f.taken) }()
+		depth_array := depthFilter{Fill: true}.filled(f.depthArray())
+		cfg, _ := circleDetectionConfig()
+		for _, circle := range detectCirclesIn(f.image("rgb"), cfg) {
+			circle.Z = circle.depthAt(depth_array)
+			f.circles = append(f.circles, circle)
+		}
+	})
+	return f.circles
+}
+
+// image returns the frame image of type depth, ir or rgb, the latest frame
+// of its capture loop if that was taken during the last frame interval
+func (f *hubFrame) image(frameType string) image.Image {
+	i := f.images[frameType]
+	i.once.Do(func() {
+		frame := captureLoops[frameType].recent(f.taken, time.Second/maxFPS)
+		i.img, i.timestamp = frame.img, frame.timestamp
+	})
+	return i.img
+}
+
+// imageTimestamp returns the device timestamp of an image taken with image
+func (f *hubFrame) imageTimestamp(frameType string) uint32 {
+	return f.images[frameType].timestamp
+}
+
+// message returns the message cached under key, encoding it once with build
+func (f *hubFrame) message(key string, build func() (message, error)) (message, error) {
+	f.mutex.Lock()
+	m, ok := f.messages[key]
+	if !ok {
+		m = &hubMessage{}
+		f.messages[key] = m
+	}
+	f.mutex.Unlock()
+	m.once.Do(func() { m.m, m.err = build() })
+	return m.m, m.err
+}
+
+// hub ticks as fast as its fastest client asks for and hands every client the
+// latest frame on its ticks channel
+type hub struct {
+	mutex   sync.Mutex
+	clients map[chan *hubFrame]time.Duration
+	running bool
+}
+
+var streamHub = &hub{clients: map[chan *hubFrame]time.Duration{}}
+
+// subscribe sets the interval a client wants frames at, 0 unsubscribes.
+// ticks must have a buffer of one.
+func (h *hub) subscribe(ticks chan *hubFrame, interval time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if interval <= 0 {
+		delete(h.clients, ticks)
+		return
+	}
+	h.clients[ticks] = interval
+	if !h.running {
+		h.running = true
+		go h.run()
+	}
+}
+
+func (h *hub) unsubscribe(ticks chan *hubFrame) {
+	h.subscribe(ticks, 0)
+}
+
+func (h *hub) run() {
+	next := time.Now()
+	for {
+		h.mutex.Lock()
+		var interval time.Duration
+		for _, d := range h.clients {
+			if interval == 0 || d < interval {
+				interval = d
+			}
+		}
+		if interval == 0 {
+			h.running = false
+			h.mutex.Unlock()
+			return
+		}
+		f := newHubFrame()
+		for ticks := range h.clients {
+			// latest frame wins, the hub is the only sender
+			select {
+			case ticks <- f:
+			default:
+				select {
+				case <-ticks:
+				default:
+				}
+				ticks <- f
+			}
+		}
+		h.mutex.Unlock()
+
+		next = next.Add(interval)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		time.Sleep(time.Until(next))
+	}
+}
@@ -23,12 +23,22 @@ import (
 	_ "github.com/moethu/gosand/server/docs"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"google.golang.org/grpc"
 )
 
 var freenect_device *freenect.FreenectDevice
 var led_sleep_time time.Duration
 var image_quality = 100
 var freenect_device_present = false
+var mqtt_config string
+var osc_config string
+var grpc_port string
+var multicast_config string
+var max_clients = 8
+var max_clients_per_ip = 4
+var min_interval = 1000 / maxFPS
+var admin_token string
+var trust_proxy bool
 
 // @title Gosand Server API
 // @version 0.5
@@ -37,9 +47,21 @@ var freenect_device_present = false
 // @contact.name API Support
 // @contact.url http://github.com/moethu/gosand
 func main() {
+	flag.IntVar(&image_quality, "quality", 100, "default JPEG quality 1-100")
+	flag.StringVar(&mqtt_config, "mqtt", "", "MQTT publisher config file, publishing is off without")
+	flag.StringVar(&osc_config, "osc", "", "OSC sender config file, sending is off without")
+	flag.StringVar(&multicast_config, "multicast", "", "UDP multicast sender config file, sending is off without")
+	flag.StringVar(&grpc_port, "grpc", ":4778", "gRPC listen address, empty to turn it off")
+	flag.IntVar(&max_clients, "max-clients", 8, "maximum number of streaming clients of /stream/, /tin/stream/, /mjpeg/, /events and gRPC Subscribe, 0 for no limit")
+	flag.IntVar(&max_clients_per_ip, "max-clients-per-ip", 4, "maximum number of streaming clients per IP address, 0 for no limit")
+	flag.IntVar(&min_interval, "min-interval", 1000/maxFPS, "shortest channel or /tin/stream/ interval in ms stream clients may ask for")
+	flag.StringVar(&admin_token, "admin-token", "", "bearer token required by the /admin/ endpoints, only localhost may use them without")
+	flag.BoolVar(&trust_proxy, "trust-proxy", false, "take client addresses from X-Forwarded-For, only behind a reverse proxy")
 	flag.Parse()
+	if min_interval < 1000/maxFPS {
+		min_interval = 1000 / maxFPS
+	}
 	log.SetFlags(0)
-	circleDetectionConfig = config{}
 	led_sleep_time, _ = time.ParseDuration("200ms")
 
 	freenect_device = freenect.NewFreenectDevice(0)
@@ -51,6 +73,31 @@ func main() {
 		ledStartup(freenect_device)
 		freenect_device_present = true
 	}
+	events.publish("device", deviceStatus{Present: freenect_device_present})
+
+	if mqtt_config != "" {
+		if err := startMQTT(mqtt_config); err != nil {
+			log.Println("MQTT:", err)
+		}
+	}
+	if osc_config != "" {
+		if err := startOSC(osc_config); err != nil {
+			log.Println("OSC:", err)
+		}
+	}
+
+	if multicast_config != "" {
+		if err := startMulticast(multicast_config); err != nil {
+			log.Println("Multicast:", err)
+		}
+	}
+	var rpc *grpc.Server
+	if grpc_port != "" {
+		var err error
+		if rpc, err = startGRPC(grpc_port); err != nil {
+			log.Println("gRPC:", err)
+		}
+	}
 
 	router := gin.Default()
 	port := ":4777"
@@ -60,12 +107,37 @@ func main() {
 		ReadTimeout:  600 * time.Second,
 		WriteTimeout: 600 * time.Second,
 	}
+	// websockets and other hijacked streams are not waited for by Shutdown,
+	// they end with the server context once no new connections are accepted
+	srv.RegisterOnShutdown(cancelServer)
 
 	router.Static("/static/", "./static/")
 	router.GET("/data/", GetArray)
 	router.POST("/config/", PostCircles)
 	router.GET("/frame/:type/", GetFrame)
+	router.GET("/frame/:type", GetFrame)
+	router.GET("/palette/", GetPalettes)
+	router.POST("/palette/:name/", adminAuth, PostPalette)
+	router.GET("/export/mesh.stl", GetMesh)
+	router.GET("/export/dem.tif", GetDEM)
+	router.GET("/export/dem.asc", GetDEM)
+	router.GET("/export/contours.geojson", GetContours)
+	router.GET("/export/contours.svg", GetContours)
+	router.GET("/export/contours.dxf", GetContours)
+	router.GET("/export/depth.npy", GetNPY)
+	router.GET("/export/rgbd.zip", GetRGBD)
+	router.GET("/export/cloud.pcd", GetCloud)
+	router.GET("/export/cloud.las", GetCloud)
+	router.GET("/export/tin.json", GetTIN)
+	router.GET("/export/tin.bin", GetTIN)
+	router.GET("/tiles/:z/:x/:y", GetTile)
+	router.GET("/tin/stream/", ServeTIN)
+	router.GET("/mjpeg/:type/", ServeMJPEG)
 	router.Any("/stream/:time/", ServeWebsocket)
+	router.GET("/events", ServeEvents)
+	admin := router.Group("/admin/", adminAuth)
+	admin.GET("/clients", GetClients)
+	admin.DELETE("/clients/:id", DeleteClient)
 	router.GET("/", home)
 	router.GET("/socket", socket)
 
@@ -84,16 +156,36 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutdown Server")
-	if freenect_device_present {
-		ledShutdown(freenect_device)
-		freenect_device.Stop()
-		freenect_device.Shutdown()
-	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server Shutdown: ", err)
+		log.Println("Server Shutdown:", err)
+	}
+	cancelServer()
+	// streams get their own time to drain, the server may have used up ctx
+	drain, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelDrain()
+	if rpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			rpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-drain.Done():
+			rpc.Stop()
+		}
+	}
+	// streams close with a close frame, the device is stopped once nothing reads from it anymore
+	if err := deviceUsers.stop(drain); err != nil {
+		log.Println("Streams still running:", err)
+	}
+	if freenect_device_present {
+		ledShutdown(freenect_device)
+		freenect_device.Stop()
+		freenect_device.Shutdown()
 	}
 	log.Println("Server exiting")
 }
@@ -119,11 +211,32 @@ func ledShutdown(d *freenect.FreenectDevice) {
 // @Description gets the current frame
 // @Accept  json
 // @Produce  jpeg
-// @Param type path string true "Frame Type depth, ir or rgb"
+// @Param type path string true "Frame Type depth, ir, rgb, elevation, depth16.png (16-bit PNG in mm), slope, aspect, profile, plan or normal"
+// @Param palette query string false "elevation only: palette name, default terrain"
+// @Param min query number false "elevation only: height in mm mapped to the first palette colour"
+// @Param max query number false "elevation only: height in mm mapped to the last palette colour"
+// @Param hillshade query number false "elevation only: hillshade blending 0 to 1, default 0"
+// @Param azimuth query number false "elevation only: sun azimuth in degrees, default 315"
+// @Param altitude query number false "elevation only: sun altitude in degrees, default 45"
+// @Param contours query number false "elevation only: contour interval in mm, at least 1"
+// @Param format query string false "elevation only: png (default) or jpeg"
+// @Param quality query int false "JPEG quality 1-100, default server quality"
 // @Success 200 byte jpeg
+// @Failure 400 {object} string
 // @Failure 404 {object} string
 // @Router /frame/{type}/ [get]
 func GetFrame(c *gin.Context) {
+	switch c.Params.ByName("type") {
+	case "elevation":
+		GetElevation(c)
+		return
+	case "depth16.png":
+		GetDepth16(c)
+		return
+	case derivativeSlope, derivativeAspect, derivativeProfile, derivativePlan, "normal":
+		GetDerivative(c)
+		return
+	}
 	freenect_device.SetLed(freenect.LED_GREEN)
 	var img image.Image
 	switch c.Params.ByName("type") {
@@ -140,8 +253,12 @@ func GetFrame(c *gin.Context) {
 		c.Data(404, "", nil)
 		return
 	}
+	quality := queryInt(c, "quality", image_quality)
+	if quality < 1 || quality > 100 {
+		quality = image_quality
+	}
 	c.Writer.Header().Set("Content-Type", "image/jpeg")
-	jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: image_quality})
+	jpeg.Encode(c.Writer, img, &jpeg.Options{Quality: quality})
 	freenect_device.SetLed(freenect.LED_OFF)
 }
 
@@ -149,24 +266,42 @@ func GetFrame(c *gin.Context) {
 // @Summary Get Depth Array
 // @Description gets the current frames depth array
 // @Accept  json
-// @Produce  json
+// @Produce  json,application/msgpack,application/cbor,octet-stream
+// @Param contours query number false "Contour interval in mm, at least 1, contour lines are sent in l"
+// @Param channels query string false "Comma separated slope, aspect, profile, plan sent in f as float32 rasters, binary with msgpack and cbor"
+// @Param format query string false "json, msgpack, cbor or raw, overrides the Accept header"
 // @Success 200 {array} byte
-// @Router /deptharray/ [get]
+// @Failure 400 {object} string
+// @Router /data/ [get]
 func GetArray(c *gin.Context) {
+	terrain, err := terrainOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
 	cdetection := c.Request.URL.Query().Get("detection")
 	freenect_device.SetLed(freenect.LED_GREEN)
-	depth_array := freenect_device.DepthArray(true)
+	taken := time.Now()
+	depth_array, timestamp := freenect_device.DepthArrayWithTimestamp(true)
 
 	var cs []circle
 	if cdetection != "" {
-		cs = detectCircles(circleDetectionConfig)
+		cfg, _ := circleDetectionConfig()
+		cs = detectCircles(cfg)
 		for i, circle := range cs {
-			depth := depth_array[int(circle.X*480+circle.Y)]
-			cs[i].Z = int(depth)
+			cs[i].Z = circle.depthAt(depth_array)
 		}
 	}
 
-	c.JSON(200, payload{Depthframe: depth_array, Circles: cs})
+	p := payload{Depthframe: depth_array, Circles: cs}
+	p.frameMeta = newFrameMeta(taken, timestamp)
+	p.Seq = nextFrameSeq()
+	p.describe(nil, unitsDepthArray)
+	if cdetection != "" {
+		p.Latency = milliseconds(time.Since(taken))
+	}
+	terrain.apply(&p)
+	writePayload(c, p)
 	freenect_device.SetLed(freenect.LED_OFF)
 }
 
@@ -176,18 +311,25 @@ func GetArray(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Success 200 {array} byte
-// @Router /circles/ [post]
+// @Failure 400 {object} string
+// @Router /config/ [post]
 func PostCircles(c *gin.Context) {
 	jsonData, err := ioutil.ReadAll(c.Request.Body)
 	if err != nil {
 		c.JSON(500, err)
+		return
 	}
 	var cfg config
 	err = json.Unmarshal(jsonData, &cfg)
 	if err != nil {
 		c.JSON(500, err)
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		c.JSON(400, err.Error())
+		return
 	}
-	circleDetectionConfig = cfg
+	setCircleDetectionConfig(cfg)
 	c.JSON(200, "OK")
 }
 
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+type vec3 [3]float32
+
+// meshOptions control how a heightfield is turned into a mesh
+type meshOptions struct {
+	Step          int     // grid subsampling in pixels
+	Pitch         float64 // size of a pixel on the sand in mm
+	Exaggeration  float64 // vertical exaggeration
+	Size          float64 // target size of the longest side in mm, 0 keeps model scale
+	BaseThickness float64 // solid base below the lowest point in mm (after scaling)
+	Solid         bool    // close the surface with walls and a bottom
+}
+
+// validate rejects options that would give a flat, mirrored or open mesh
+func (opt meshOptions) validate() error {
+	if opt.Step < 1 {
+		return errors.New("step must be at least 1")
+	}
+	if opt.Pitch <= 0 || opt.Exaggeration <= 0 {
+		return errors.New("pitch and exaggeration must be positive")
+	}
+	if opt.Size < 0 {
+		return errors.New("size must not be negative, 0 keeps the model scale")
+	}
+	if opt.Solid && opt.BaseThickness <= 0 {
+		return errors.New("thickness of a solid must be positive")
+	}
+	return nil
+}
+
+// meshBuilder maps grid coordinates of a heightfield to scaled model space
+type meshBuilder struct {
+	h     heightfield
+	opt   meshOptions
+	scale float64
+	zmin  float64
+}
+
+func newMeshBuilder(h heightfield, opt meshOptions) meshBuilder {
+	if opt.Step < 1 {
+		opt.Step = 1
+	}
+	h = h.Downsample(opt.Step).Filled()
+	zmin, _ := h.Range()
+	scale := 1.0
+	if opt.Size > 0 {
+		extent := math.Max(float64(h.Width-1), float64(h.Height-1)) * float64(opt.Step) * opt.Pitch
+		if extent > 0 {
+			scale = opt.Size / extent
+		}
+	}
+	return meshBuilder{h: h, opt: opt, scale: scale, zmin: zmin}
+}
+
+// top returns the surface vertex for grid column x and row y.
+// Rows are flipped so the model reads like the camera image from above.
+func (m meshBuilder) top(x, y int) vec3 {
+	z := (m.h.At(x, y)-m.zmin)*m.opt.Exaggeration*m.scale + m.base()
+	return m.bottom(x, y, float32(z))
+}
+
+func (m meshBuilder) bottom(x, y int, z float32) vec3 {
+	step := float64(m.opt.Step) * m.opt.Pitch * m.scale
+	return vec3{float32(float64(x) * step), float32(float64(m.h.Height-1-y) * step), z}
+}
+
+func (m meshBuilder) base() float64 {
+	if m.opt.Solid {
+		return m.opt.BaseThickness
+	}
+	return 0
+}
+
+// outline returns the grid border counter-clockwise as seen from above
+func (m meshBuilder) outline() [][2]int {
+	w, h := m.h.Width, m.h.Height
+	var pts [][2]int
+	for x := 0; x < w-1; x++ {
+		pts = append(pts, [2]int{x, h - 1})
+	}
+	for y := h - 1; y > 0; y-- {
+		pts = append(pts, [2]int{w - 1, y})
+	}
+	for x := w - 1; x > 0; x-- {
+		pts = append(pts, [2]int{x, 0})
+	}
+	for y := 0; y < h-1; y++ {
+		pts = append(pts, [2]int{0, y})
+	}
+	return pts
+}
+
+func (m meshBuilder) triangleCount() uint32 {
+	n := 2 * (m.h.Width - 1) * (m.h.Height - 1)
+	if m.opt.Solid {
+		// two wall triangles and one bottom triangle per border edge
+		n += 3 * len(m.outline())
+	}
+	return uint32(n)
+}
+
+// triangles emits all triangles with outward facing counter-clockwise winding
+func (m meshBuilder) triangles(emit func(a, b, c vec3) error) error {
+	for y := 0; y < m.h.Height-1; y++ {
+		for x := 0; x < m.h.Width-1; x++ {
+			a, b, c, d := m.top(x, y), m.top(x+1, y), m.top(x, y+1), m.top(x+1, y+1)
+			if err := emit(c, d, b); err != nil {
+				return err
+			}
+			if err := emit(c, b, a); err != nil {
+				return err
+			}
+		}
+	}
+	if !m.opt.Solid {
+		return nil
+	}
+
+	outline := m.outline()
+	corner := m.bottom(m.h.Width-1, 0, 0)
+	center := vec3{corner[0] / 2, corner[1] / 2, 0}
+	for i, p := range outline {
+		q := outline[(i+1)%len(outline)]
+		pt, qt := m.top(p[0], p[1]), m.top(q[0], q[1])
+		pb, qb := m.bottom(p[0], p[1], 0), m.bottom(q[0], q[1], 0)
+		if err := emit(pb, qb, qt); err != nil {
+			return err
+		}
+		if err := emit(pb, qt, pt); err != nil {
+			return err
+		}
+		if err := emit(center, qb, pb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSTL writes the mesh as binary STL
+func writeSTL(w io.Writer, m meshBuilder) error {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 80)
+	copy(header, "gosand heightfield")
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, m.triangleCount()); err != nil {
+		return err
+	}
+	buf := make([]byte, 50)
+	err := m.triangles(func(a, b, c vec3) error {
+		n := normal(a, b, c)
+		for i, v := range []vec3{n, a, b, c} {
+			for j := 0; j < 3; j++ {
+				binary.LittleEndian.PutUint32(buf[i*12+j*4:], math.Float32bits(v[j]))
+			}
+		}
+		_, err := bw.Write(buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func normal(a, b, c vec3) vec3 {
+	u := vec3{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	v := vec3{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+	n := vec3{u[1]*v[2] - u[2]*v[1], u[2]*v[0] - u[0]*v[2], u[0]*v[1] - u[1]*v[0]}
+	l := float32(math.Sqrt(float64(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])))
+	if l == 0 {
+		return vec3{}
+	}
+	return vec3{n[0] / l, n[1] / l, n[2] / l}
+}
+
+// GetMesh godoc
+// @Summary Get Mesh as STL
+// @Description gets the current depth frame as binary STL mesh, mode=solid closes it into a printable solid
+// @Produce  octet-stream
+// @Param mode query string false "surface (default) or solid"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Param step query int false "Grid subsampling in pixels, default 2"
+// @Param pitch query number false "Size of a pixel on the sand in mm, default 1.7"
+// @Param exaggeration query number false "Vertical exaggeration, default 1"
+// @Param size query number false "Target print size of the longest side in mm"
+// @Param thickness query number false "Solid base thickness in mm, default 3"
+// @Success 200 byte stl
+// @Failure 400 {object} string
+// @Router /export/mesh.stl [get]
+func GetMesh(c *gin.Context) {
+	mode := c.Request.URL.Query().Get("mode")
+	if mode != "" && mode != "surface" && mode != "solid" {
+		c.JSON(400, "mode must be surface or solid")
+		return
+	}
+	opt := meshOptions{
+		Step:          queryInt(c, "step", 2),
+		Pitch:         queryFloat(c, "pitch", 1.7),
+		Exaggeration:  queryFloat(c, "exaggeration", 1),
+		Size:          queryFloat(c, "size", 0),
+		BaseThickness: queryFloat(c, "thickness", 3),
+		Solid:         mode == "solid",
+	}
+	if err := opt.validate(); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+	m := newMeshBuilder(captureHeightfield(c), opt)
+
+	c.Writer.Header().Set("Content-Type", "model/stl")
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand.stl")
+	if err := writeSTL(c.Writer, m); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestSTL(t *testing.T) {
+	h := heightfield{Width: 5, Height: 4, Z: make([]float64, 20)}
+	for i := range h.Z {
+		h.Z[i] = 10
+	}
+	h.Z[6] = 20
+	tests := []struct {
+		name      string
+		opt       meshOptions
+		triangles int
+		volume    float64 // of solids, base plus the tent of six triangles around the raised pixel
+	}{
+		{"surface", meshOptions{Step: 1, Pitch: 1, Exaggeration: 1}, 24, 0},
+		{"solid", meshOptions{Step: 1, Pitch: 1, Exaggeration: 1, BaseThickness: 3, Solid: true}, 24 + 3*14, 4*3*3 + 6*0.5*10/3},
+		{"scaled solid", meshOptions{Step: 1, Pitch: 1, Exaggeration: 2, Size: 8, BaseThickness: 3, Solid: true}, 24 + 3*14, 8*6*3 + 6*2*40/3},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeSTL(&buf, newMeshBuilder(h, tt.opt)); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		count := int(binary.LittleEndian.Uint32(b[80:]))
+		if count != tt.triangles || len(b) != 84+50*count {
+			t.Errorf("%s: %d triangles in %d bytes, want %d", tt.name, count, len(b), tt.triangles)
+			continue
+		}
+		if !tt.opt.Solid {
+			continue
+		}
+		// a closed mesh has every edge once in each direction, the signed
+		// volume of outward facing triangles is positive
+		edges := map[[2]vec3]int{}
+		volume := 0.0
+		for i := 0; i < count; i++ {
+			var v [4]vec3
+			binary.Read(bytes.NewReader(b[84+50*i:]), binary.LittleEndian, &v)
+			a, p, q := v[1], v[2], v[3]
+			edges[[2]vec3{a, p}]++
+			edges[[2]vec3{p, q}]++
+			edges[[2]vec3{q, a}]++
+			volume += float64(a[0]*(p[1]*q[2]-p[2]*q[1])-a[1]*(p[0]*q[2]-p[2]*q[0])+a[2]*(p[0]*q[1]-p[1]*q[0])) / 6
+		}
+		for e, n := range edges {
+			if n != 1 || edges[[2]vec3{e[1], e[0]}] != 1 {
+				t.Errorf("%s: edge %v used %d times, reverse %d times", tt.name, e, n, edges[[2]vec3{e[1], e[0]}])
+				break
+			}
+		}
+		if math.Abs(volume-tt.volume) > 1e-3 {
+			t.Errorf("%s: volume %v, want %v", tt.name, volume, tt.volume)
+		}
+	}
+}
+
+func TestMeshOptionsValidate(t *testing.T) {
+	valid := meshOptions{Step: 2, Pitch: 1.7, Exaggeration: 1, BaseThickness: 3, Solid: true}
+	tests := []struct {
+		name   string
+		change func(o *meshOptions)
+		err    bool
+	}{
+		{"defaults", func(o *meshOptions) {}, false},
+		{"surface without thickness", func(o *meshOptions) { o.Solid = false; o.BaseThickness = 0 }, false},
+		{"solid without thickness", func(o *meshOptions) { o.BaseThickness = 0 }, true},
+		{"negative thickness", func(o *meshOptions) { o.BaseThickness = -1 }, true},
+		{"zero pitch", func(o *meshOptions) { o.Pitch = 0 }, true},
+		{"negative exaggeration", func(o *meshOptions) { o.Exaggeration = -2 }, true},
+		{"zero step", func(o *meshOptions) { o.Step = 0 }, true},
+		{"negative size", func(o *meshOptions) { o.Size = -100 }, true},
+	}
+	for _, tt := range tests {
+		o := valid
+		tt.change(&o)
+		if err := o.validate(); (err != nil) != tt.err {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+const maxFPS = 30
+
+// hijackStream takes over the connection for a long running response, so it
+// is not cut by the server's WriteTimeout, and writes the response header
+func hijackStream(c *gin.Context, contentType string) (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := c.Writer.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	fmt.Fprintf(rw, "HTTP/1.1 200 OK\r\nContent-Type: %s\r\nCache-Control: no-cache\r\nConnection: close\r\n\r\n", contentType)
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
+
+// ServeMJPEG godoc
+// @Summary Serves a MJPEG stream
+// @Description Serves frames as multipart/x-mixed-replace, all viewers share one capture loop per frame type
+// @Produce  multipart/x-mixed-replace
+// @Param type path string true "Frame Type depth, ir or rgb"
+// @Param fps query int false "Frames per second, default 10"
+// @Param quality query int false "JPEG quality 1-100, default server quality"
+// @Success 200 byte jpeg
+// @Failure 404 {object} string
+// @Failure 503 {object} string
+// @Router /mjpeg/{type}/ [get]
+func ServeMJPEG(c *gin.Context) {
+	loop, ok := captureLoops[c.Params.ByName("type")]
+	if !ok {
+		c.Data(404, "", nil)
+		return
+	}
+	fps := queryInt(c, "fps", 10)
+	if fps < 1 {
+		fps = 1
+	} else if fps > maxFPS {
+		fps = maxFPS
+	}
+	quality := queryInt(c, "quality", image_quality)
+	if quality < 1 || quality > 100 {
+		quality = image_quality
+	}
+
+	client := newEndpointClient(kindMJPEG)
+	id, err := streamClients.add(remoteIP(c), client)
+	if err != nil {
+		c.JSON(503, err.Error())
+		return
+	}
+	defer streamClients.remove(id)
+
+	conn, rw, err := hijackStream(c, "multipart/x-mixed-replace; boundary=frame")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+	if !deviceUsers.enter() {
+		return
+	}
+	defer deviceUsers.leave()
+
+	interval := time.Second / time.Duration(fps)
+	loopID := loop.subscribe(interval)
+	defer loop.unsubscribe(loopID)
+	if freenect_device_present {
+		freenect_device.SetLed(freenect.LED_BLINK_GREEN)
+		defer freenect_device.SetLed(freenect.LED_OFF)
+	}
+
+	var seq uint64
+	for serverContext.Err() == nil && !client.disconnected() {
+		start := time.Now()
+		frame := loop.next(seq)
+		seq = frame.seq
+		b := frame.jpeg(quality)
+
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		fmt.Fprintf(rw, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(b))
+		rw.Write(b)
+		rw.WriteString("\r\n")
+		if err := rw.Flush(); err != nil {
+			return
+		}
+		time.Sleep(interval - time.Since(start))
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttConfig is read from the file given with -mqtt
+type mqttConfig struct {
+	Broker          string     `json:"broker"`
+	ClientID        string     `json:"client_id"`
+	Username        string     `json:"username"`
+	Password        string     `json:"password"`
+	QoS             byte       `json:"qos"`
+	Interval        int        `json:"interval"`         // ms between zone metrics
+	Base            float64    `json:"base"`             // distance camera to baseline in mm, 0 for the farthest point
+	CellSize        float64    `json:"cellsize"`         // pixel size on the sand in mm
+	VolumeThreshold float64    `json:"volume_threshold"` // change in cm³ that is published as volume change
+	Topics          mqttTopics `json:"topics"`
+	Zones           []zone     `json:"zones"`
+}
+
+// mqttTopics are the topics published to, zone metrics go to <zones>/<name>
+type mqttTopics struct {
+	Circles string `json:"circles"` // retained list of tracked circles
+	Enter   string `json:"enter"`
+	Leave   string `json:"leave"`
+	Zones   string `json:"zones"`  // retained height and volume per zone, changes to <zones>/<name>/volume_change
+	Status  string `json:"status"` // retained online or offline
+}
+
+// zone is a named region of the frame, roi is x, y, width, height in pixels
+type zone struct {
+	Name string `json:"name"`
+	ROI  []int  `json:"roi"`
+}
+
+// zoneMetrics describe the sand inside a zone
+type zoneMetrics struct {
+	Height float64 `json:"height"` // average height in mm
+	Volume float64 `json:"volume"` // sand volume above the baseline in cm³
+}
+
+type volumeChange struct {
+	Volume float64 `json:"volume"`
+	Change float64 `json:"change"`
+}
+
+func loadMQTTConfig(path string) (mqttConfig, error) {
+	cfg := mqttConfig{
+		Broker:          "tcp://localhost:1883",
+		ClientID:        "gosand",
+		QoS:             1,
+		Interval:        1000,
+		CellSize:        1.7,
+		VolumeThreshold: 50,
+		Topics: mqttTopics{
+			Circles: "gosand/circles",
+			Enter:   "gosand/circle/enter",
+			Leave:   "gosand/circle/leave",
+			Zones:   "gosand/zones",
+			Status:  "gosand/status",
+		},
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	if len(cfg.Zones) == 0 {
+		cfg.Zones = []zone{{Name: "all"}}
+	}
+	for _, z := range cfg.Zones {
+		if err := z.validate(); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Interval < 1000/maxFPS {
+		cfg.Interval = 1000 / maxFPS
+	}
+	return cfg, nil
+}
+
+// validate checks that the roi of a zone lies inside the 640x480 frame
+func (z zone) validate() error {
+	if z.Name == "" {
+		return fmt.Errorf("zone without name")
+	}
+	if z.ROI == nil {
+		return nil
+	}
+	if len(z.ROI) != 4 || z.ROI[0] < 0 || z.ROI[1] < 0 || z.ROI[2] < 1 || z.ROI[3] < 1 ||
+		z.ROI[0]+z.ROI[2] > frameWidth || z.ROI[1]+z.ROI[3] > frameHeight {
+		return fmt.Errorf("roi of zone %s must be [x, y, width, height] inside the 640x480 frame", z.Name)
+	}
+	return nil
+}
+
+// metrics averages the height and sums the volume of the valid pixels of a zone
+func (z zone) metrics(h heightfield, cellsize float64) zoneMetrics {
+	x0, y0, x1, y1 := 0, 0, h.Width, h.Height
+	if len(z.ROI) == 4 {
+		x0, y0 = z.ROI[0], z.ROI[1]
+		x1, y1 = x0+z.ROI[2], y0+z.ROI[3]
+	}
+	var sum float64
+	var n int
+	for y := y0; y < y1 && y < h.Height; y++ {
+		for x := x0; x < x1 && x < h.Width; x++ {
+			if h.Valid(x, y) {
+				sum += h.At(x, y)
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return zoneMetrics{}
+	}
+	return zoneMetrics{Height: sum / float64(n), Volume: sum * cellsize * cellsize / 1000}
+}
+
+// mqttMessage is a publication to the broker, payloads are sent as JSON
+type mqttMessage struct {
+	Topic    string
+	Retained bool
+	Payload  interface{}
+}
+
+// eventMessages returns the publications of a server event
+func (cfg mqttConfig) eventMessages(e event) []mqttMessage {
+	switch e.Type {
+	case "circles":
+		return []mqttMessage{{cfg.Topics.Circles, true, e.Data}}
+	case "enter":
+		return []mqttMessage{{cfg.Topics.Enter, false, e.Data}}
+	case "leave":
+		return []mqttMessage{{cfg.Topics.Leave, false, e.Data}}
+	}
+	return nil
+}
+
+// zoneMessages returns the metrics of every zone and their volume changes
+// since the volumes published last, which are updated
+func (cfg mqttConfig) zoneMessages(h heightfield, volumes map[string]float64) []mqttMessage {
+	var messages []mqttMessage
+	for _, z := range cfg.Zones {
+		m := z.metrics(h, cfg.CellSize)
+		topic := cfg.Topics.Zones + "/" + z.Name
+		messages = append(messages, mqttMessage{topic, true, m})
+		last, ok := volumes[z.Name]
+		if !ok {
+			volumes[z.Name] = m.Volume
+		} else if math.Abs(m.Volume-last) >= cfg.VolumeThreshold {
+			messages = append(messages, mqttMessage{topic + "/volume_change", false, volumeChange{Volume: m.Volume, Change: m.Volume - last}})
+			volumes[z.Name] = m.Volume
+		}
+	}
+	return messages
+}
+
+// publish sends messages without waiting for the broker, paho queues and
+// retries with QoS > 0
+func (cfg mqttConfig) publish(client mqtt.Client, messages []mqttMessage) {
+	// while the broker can't be reached publishes would pile up in the store,
+	// the retained state goes out again with the next tick
+	if !client.IsConnectionOpen() {
+		return
+	}
+	for _, m := range messages {
+		b, err := json.Marshal(m.Payload)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		client.Publish(m.Topic, cfg.QoS, m.Retained, b)
+	}
+}
+
+// mqttRetryInterval is the wait between connects while the broker is unreachable
+const mqttRetryInterval = 10 * time.Second
+
+// startMQTT connects to the broker and publishes detections and zone metrics
+func startMQTT(path string) error {
+	cfg, err := loadMQTTConfig(path)
+	if err != nil {
+		return err
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(mqttRetryInterval).
+		SetWill(cfg.Topics.Status, "offline", cfg.QoS, true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			client.Publish(cfg.Topics.Status, cfg.QoS, true, "online")
+		})
+	client := mqtt.NewClient(opts)
+	// with ConnectRetry the token completes once the broker is reached, until
+	// then the connect is retried in the background
+	token := client.Connect()
+	go func() {
+		if token.Wait() && token.Error() == nil {
+			log.Println("Connected to MQTT broker", cfg.Broker)
+		}
+	}()
+	log.Println("Publishing to MQTT broker", cfg.Broker)
+	deviceUsers.enter()
+	go publishMQTT(client, cfg)
+	return nil
+}
+
+func publishMQTT(client mqtt.Client, cfg mqttConfig) {
+	defer deviceUsers.leave()
+	defer func() {
+		// the will is only sent for lost connections
+		if client.IsConnectionOpen() {
+			client.Publish(cfg.Topics.Status, cfg.QoS, true, "offline").WaitTimeout(time.Second)
+		}
+		client.Disconnect(250)
+	}()
+	queue := events.subscribe()
+	defer events.unsubscribe(queue)
+	ticks := make(chan *hubFrame, 1)
+	defer streamHub.unsubscribe(ticks)
+	streamHub.subscribe(ticks, time.Duration(cfg.Interval)*time.Millisecond)
+
+	volumes := map[string]float64{}
+	for {
+		select {
+		case <-serverContext.Done():
+			return
+
+		case e := <-queue:
+			cfg.publish(client, cfg.eventMessages(e))
+
+		case f := <-ticks:
+			cfg.publish(client, cfg.zoneMessages(newHeightfield(f.depthArray16(), cfg.Base), volumes))
+		}
+	}
+}
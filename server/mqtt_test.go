@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// testHeightfield returns a 640x480 heightfield of height z with the left
+// half of the top row invalid
+func testHeightfield(z float64) heightfield {
+	h := heightfield{Width: frameWidth, Height: frameHeight, Z: make([]float64, frameWidth*frameHeight)}
+	for i := range h.Z {
+		h.Z[i] = z
+	}
+	for x := 0; x < frameWidth/2; x++ {
+		h.Z[x] = math.NaN()
+	}
+	return h
+}
+
+func TestZoneMetrics(t *testing.T) {
+	h := testHeightfield(10)
+	h.Z[100*frameWidth+100] = 110
+	tests := []struct {
+		name string
+		roi  []int
+		want zoneMetrics
+	}{
+		{"whole frame", nil, zoneMetrics{Height: (10*float64(frameWidth*frameHeight-frameWidth/2) + 100) / float64(frameWidth*frameHeight-frameWidth/2), Volume: (10*float64(frameWidth*frameHeight-frameWidth/2) + 100) * 4 / 1000}},
+		{"one pixel", []int{100, 100, 1, 1}, zoneMetrics{Height: 110, Volume: 110 * 4 / 1000.0}},
+		{"flat square", []int{200, 200, 10, 10}, zoneMetrics{Height: 10, Volume: 1000 * 4 / 1000.0}},
+		{"invalid pixels only", []int{0, 0, 10, 1}, zoneMetrics{}},
+		{"bottom right corner", []int{630, 470, 10, 10}, zoneMetrics{Height: 10, Volume: 1000 * 4 / 1000.0}},
+	}
+	for _, tt := range tests {
+		got := zone{Name: tt.name, ROI: tt.roi}.metrics(h, 2)
+		if math.Abs(got.Height-tt.want.Height) > 1e-9 || math.Abs(got.Volume-tt.want.Volume) > 1e-9 {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestZoneValidate(t *testing.T) {
+	tests := []struct {
+		roi []int
+		ok  bool
+	}{
+		{nil, true},
+		{[]int{0, 0, 640, 480}, true},
+		{[]int{630, 470, 10, 10}, true},
+		{[]int{-1, 0, 10, 10}, false},
+		{[]int{0, -5, 10, 10}, false},
+		{[]int{0, 0, 0, 10}, false},
+		{[]int{0, 0, 10, -1}, false},
+		{[]int{631, 0, 10, 10}, false},
+		{[]int{0, 471, 10, 10}, false},
+		{[]int{0, 0, 10}, false},
+	}
+	for _, tt := range tests {
+		if err := (zone{Name: "z", ROI: tt.roi}).validate(); (err == nil) != tt.ok {
+			t.Errorf("roi %v: got error %v, want ok %v", tt.roi, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadMQTTConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mqtt.json")
+
+	ioutil.WriteFile(path, []byte(`{"interval":1,"topics":{"zones":"sand/zones"}}`), 0644)
+	cfg, err := loadMQTTConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Interval != 1000/maxFPS || cfg.Topics.Zones != "sand/zones" || cfg.Topics.Circles != "gosand/circles" || len(cfg.Zones) != 1 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"zones":[{"name":"lake","roi":[-10,0,100,100]}]}`), 0644)
+	if _, err := loadMQTTConfig(path); err == nil {
+		t.Error("negative roi origin accepted")
+	}
+}
+
+func TestMQTTMessages(t *testing.T) {
+	cfg := mqttConfig{
+		CellSize:        1,
+		VolumeThreshold: 50,
+		Topics:          mqttTopics{Circles: "c", Enter: "in", Leave: "out", Zones: "z"},
+		Zones:           []zone{{Name: "a", ROI: []int{0, 10, 100, 100}}, {Name: "b", ROI: []int{100, 10, 10, 10}}},
+	}
+	tracked := []trackedCircle{{ID: 1}}
+	events := []struct {
+		e    event
+		want []mqttMessage
+	}{
+		{event{Type: "circles", Data: tracked}, []mqttMessage{{"c", true, tracked}}},
+		{event{Type: "enter", Data: tracked[0]}, []mqttMessage{{"in", false, tracked[0]}}},
+		{event{Type: "leave", Data: tracked[0]}, []mqttMessage{{"out", false, tracked[0]}}},
+		{event{Type: "config"}, nil},
+	}
+	for _, tt := range events {
+		if got := cfg.eventMessages(tt.e); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.e.Type, got, tt.want)
+		}
+	}
+
+	// the first frame sets the volumes, a change of 10000 cm³ in a and 100 cm³ in b follows
+	volumes := map[string]float64{}
+	got := cfg.zoneMessages(testHeightfield(10), volumes)
+	want := []mqttMessage{{"z/a", true, zoneMetrics{10, 100}}, {"z/b", true, zoneMetrics{10, 1}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("first frame: got %+v, want %+v", got, want)
+	}
+	got = cfg.zoneMessages(testHeightfield(1010), volumes)
+	want = []mqttMessage{
+		{"z/a", true, zoneMetrics{1010, 10100}},
+		{"z/a/volume_change", false, volumeChange{10100, 10000}},
+		{"z/b", true, zoneMetrics{1010, 101}},
+		{"z/b/volume_change", false, volumeChange{101, 100}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second frame: got %+v, want %+v", got, want)
+	}
+	if got := cfg.zoneMessages(testHeightfield(1020), volumes); len(got) != 3 {
+		t.Errorf("change below the threshold published for b: %+v", got)
+	}
+}
+
+func TestMQTTUnreachableBroker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker("tcp://" + lis.Addr().String()).
+		SetConnectRetry(true).SetConnectRetryInterval(10 * time.Millisecond))
+	token := client.Connect()
+	defer client.Disconnect(0)
+
+	// the connect keeps retrying and publishes are dropped meanwhile
+	cfg := mqttConfig{QoS: 1, CellSize: 1, Topics: mqttTopics{Zones: "gosand-test/zones"}}
+	cfg.publish(client, cfg.zoneMessages(testHeightfield(10), map[string]float64{}))
+	if token.WaitTimeout(100*time.Millisecond) || client.IsConnectionOpen() {
+		t.Fatalf("connected to a closed port: %v", token.Error())
+	}
+}
+
+// TestMQTTBroker publishes to a broker given in GOSAND_MQTT_BROKER, e.g. a
+// local Mosquitto started with `mosquitto -v`:
+//
+//	GOSAND_MQTT_BROKER=tcp://localhost:1883 go test -run MQTTBroker
+func TestMQTTBroker(t *testing.T) {
+	broker := os.Getenv("GOSAND_MQTT_BROKER")
+	if broker == "" {
+		t.Skip("GOSAND_MQTT_BROKER not set")
+	}
+	connect := func(id string) mqtt.Client {
+		client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID(id))
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			t.Fatal(token.Error())
+		}
+		return client
+	}
+	sub := connect("gosand-test-sub")
+	defer sub.Disconnect(250)
+	received := make(chan mqtt.Message, 16)
+	if token := sub.Subscribe("gosand-test/#", 1, func(_ mqtt.Client, m mqtt.Message) { received <- m }); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	pub := connect("gosand-test-pub")
+	defer pub.Disconnect(250)
+
+	cfg := mqttConfig{QoS: 1, CellSize: 1, Topics: mqttTopics{Zones: "gosand-test/zones"}, Zones: []zone{{Name: "a", ROI: []int{0, 10, 100, 100}}}}
+	cfg.publish(pub, cfg.zoneMessages(testHeightfield(10), map[string]float64{}))
+	select {
+	case m := <-received:
+		var metrics zoneMetrics
+		if err := json.Unmarshal(m.Payload(), &metrics); err != nil {
+			t.Fatal(err)
+		}
+		if m.Topic() != "gosand-test/zones/a" || metrics != (zoneMetrics{10, 100}) {
+			t.Errorf("got %s %+v", m.Topic(), metrics)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+	// clear the retained message
+	pub.Publish("gosand-test/zones/a", 1, true, []byte{}).Wait()
+}
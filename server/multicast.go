@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	multicastMagic      = "GSND"
+	multicastVersion    = 1
+	multicastHeaderSize = 32
+	maxUDPPayload       = 65507
+)
+
+// fragment types
+const (
+	fragmentData   = 0
+	fragmentParity = 1
+)
+
+// multicastConfig is read from the file given with -multicast
+type multicastConfig struct {
+	Group     string `json:"group"`     // multicast group host:port
+	Interface string `json:"interface"` // network interface to send on, default route if empty
+	TTL       int    `json:"ttl"`       // 1 stays in the local network
+	Interval  int    `json:"interval"`  // ms between depth frames
+	Fragment  int    `json:"fragment"`  // frame bytes per datagram, keep below the MTU
+	FEC       int    `json:"fec"`       // data fragments per XOR parity fragment, 0 turns FEC off
+}
+
+func loadMulticastConfig(path string) (multicastConfig, error) {
+	cfg := multicastConfig{Group: "239.255.77.77:4779", TTL: 1, Interval: 100, Fragment: 1400}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval < 1000/maxFPS {
+		cfg.Interval = 1000 / maxFPS
+	}
+	if cfg.Fragment < 64 || cfg.Fragment > maxUDPPayload-multicastHeaderSize {
+		return cfg, fmt.Errorf("fragment must be between 64 and %d bytes", maxUDPPayload-multicastHeaderSize)
+	}
+	if cfg.FEC < 0 || cfg.FEC > 255 {
+		return cfg, fmt.Errorf("fec must be between 0 and 255")
+	}
+	return cfg, nil
+}
+
+// multicastHeader starts every datagram, big endian:
+//
+//	0  magic "GSND"
+//	4  version, 1
+//	5  type, 0 data or 1 parity
+//	6  data fragment index, or FEC group index of a parity fragment
+//	8  frame sequence number
+//	12 data fragments of the frame
+//	14 data fragments per parity fragment, 0 without FEC
+//	15 reserved
+//	16 frame size in bytes
+//	20 width
+//	22 height
+//	24 capture time in ms since the epoch
+type multicastHeader struct {
+	Type     uint8
+	Index    uint16
+	Seq      uint32
+	Count    uint16
+	FEC      uint8
+	Size     uint32
+	Width    uint16
+	Height   uint16
+	Time     uint64
+	Fragment []byte
+}
+
+func (h multicastHeader) datagram() []byte {
+	b := make([]byte, multicastHeaderSize, multicastHeaderSize+len(h.Fragment))
+	copy(b, multicastMagic)
+	b[4] = multicastVersion
+	b[5] = h.Type
+	binary.BigEndian.PutUint16(b[6:], h.Index)
+	binary.BigEndian.PutUint32(b[8:], h.Seq)
+	binary.BigEndian.PutUint16(b[12:], h.Count)
+	b[14] = h.FEC
+	binary.BigEndian.PutUint32(b[16:], h.Size)
+	binary.BigEndian.PutUint16(b[20:], h.Width)
+	binary.BigEndian.PutUint16(b[22:], h.Height)
+	binary.BigEndian.PutUint64(b[24:], h.Time)
+	return append(b, h.Fragment...)
+}
+
+// fragments splits a frame into datagrams of at most size frame bytes. With
+// FEC every group of fec data fragments is followed by the XOR of them, padded
+// with zeros to size, so receivers can restore one lost fragment per group.
+func fragments(frame []byte, size, fec int, h multicastHeader) [][]byte {
+	h.Count = uint16((len(frame) + size - 1) / size)
+	h.FEC = uint8(fec)
+	h.Size = uint32(len(frame))
+	var datagrams [][]byte
+	var parity []byte
+	for i := 0; i < int(h.Count); i++ {
+		end := (i + 1) * size
+		if end > len(frame) {
+			end = len(frame)
+		}
+		h.Type, h.Index, h.Fragment = fragmentData, uint16(i), frame[i*size:end]
+		datagrams = append(datagrams, h.datagram())
+		if fec == 0 {
+			continue
+		}
+		if i%fec == 0 {
+			parity = make([]byte, size)
+		}
+		for j, b := range h.Fragment {
+			parity[j] ^= b
+		}
+		if i%fec == fec-1 || i == int(h.Count)-1 {
+			h.Type, h.Index, h.Fragment = fragmentParity, uint16(i/fec), parity
+			datagrams = append(datagrams, h.datagram())
+		}
+	}
+	return datagrams
+}
+
+// startMulticast sends depth frames to a multicast group
+func startMulticast(path string) error {
+	cfg, err := loadMulticastConfig(path)
+	if err != nil {
+		return err
+	}
+	group, err := net.ResolveUDPAddr("udp4", cfg.Group)
+	if err != nil {
+		return err
+	}
+	if !group.IP.IsMulticast() {
+		return fmt.Errorf("%s is no multicast address", group.IP)
+	}
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return err
+	}
+	p := ipv4.NewPacketConn(conn)
+	if err := p.SetMulticastTTL(cfg.TTL); err != nil {
+		return err
+	}
+	if cfg.Interface != "" {
+		ifi, err := net.InterfaceByName(cfg.Interface)
+		if err != nil {
+			return err
+		}
+		if err := p.SetMulticastInterface(ifi); err != nil {
+			return err
+		}
+	}
+	log.Println("Sending depth frames to multicast group", cfg.Group)
+	deviceUsers.enter()
+	go sendMulticast(conn, group, cfg)
+	return nil
+}
+
+func sendMulticast(conn net.PacketConn, group *net.UDPAddr, cfg multicastConfig) {
+	defer deviceUsers.leave()
+	defer conn.Close()
+	ticks := make(chan *hubFrame, 1)
+	defer streamHub.unsubscribe(ticks)
+	streamHub.subscribe(ticks, time.Duration(cfg.Interval)*time.Millisecond)
+
+	var seq uint32
+	for {
+		select {
+		case <-serverContext.Done():
+			return
+
+		case f := <-ticks:
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, f.depthArray16())
+			seq++
+			h := multicastHeader{
+				Seq:    seq,
+				Width:  frameWidth,
+				Height: frameHeight,
+				Time:   uint64(f.taken.UnixNano() / int64(time.Millisecond)),
+			}
+			for _, d := range fragments(buf.Bytes(), cfg.Fragment, cfg.FEC, h) {
+				if _, err := conn.WriteTo(d, group); err != nil {
+					// one message per frame, the next frame is tried anyway
+					log.Println("Multicast:", err)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// reassemble restores a frame from datagrams, one lost data fragment per FEC
+// group is rebuilt from the parity fragment
+func reassemble(t *testing.T, datagrams [][]byte, lost map[int]bool) []byte {
+	be := binary.BigEndian
+	var size, count, fec, fragment int
+	data := map[int][]byte{}
+	parity := map[int][]byte{}
+	for i, d := range datagrams {
+		if string(d[:4]) != multicastMagic || d[4] != multicastVersion {
+			t.Fatalf("datagram %d: bad header % x", i, d[:6])
+		}
+		count, fec, size = int(be.Uint16(d[12:])), int(d[14]), int(be.Uint32(d[16:]))
+		index := int(be.Uint16(d[6:]))
+		if d[5] == fragmentParity {
+			parity[index] = d[multicastHeaderSize:]
+			continue
+		}
+		if index == 0 {
+			fragment = len(d) - multicastHeaderSize
+		}
+		if !lost[index] {
+			data[index] = d[multicastHeaderSize:]
+		}
+	}
+	frame := make([]byte, 0, size)
+	for i := 0; i < count; i++ {
+		f, ok := data[i]
+		if !ok && fec > 0 {
+			f = append([]byte(nil), parity[i/fec]...)
+			for j := i / fec * fec; j < (i/fec+1)*fec && j < count; j++ {
+				for k, b := range data[j] {
+					f[k] ^= b
+				}
+			}
+			if end := size - i*fragment; end < len(f) {
+				f = f[:end]
+			}
+		}
+		frame = append(frame, f...)
+	}
+	return frame
+}
+
+func TestFragments(t *testing.T) {
+	frame := make([]byte, 1000)
+	for i := range frame {
+		frame[i] = byte(i * 7)
+	}
+	tests := []struct {
+		name      string
+		size, fec int
+		datagrams int
+		lost      []int
+	}{
+		{"no fec", 300, 0, 4, nil},
+		{"exact fragments", 250, 0, 4, nil},
+		{"fec lost first", 300, 2, 6, []int{0}},
+		{"fec lost last", 300, 2, 6, []int{3}},
+		{"fec one per group", 100, 3, 14, []int{1, 5, 6, 9}},
+		{"fec group of all", 300, 255, 5, []int{2}},
+	}
+	for _, tt := range tests {
+		datagrams := fragments(frame, tt.size, tt.fec, multicastHeader{Seq: 7, Width: 640, Height: 480})
+		if len(datagrams) != tt.datagrams {
+			t.Errorf("%s: %d datagrams, want %d", tt.name, len(datagrams), tt.datagrams)
+		}
+		for _, d := range datagrams {
+			if len(d) > multicastHeaderSize+tt.size {
+				t.Errorf("%s: datagram of %d bytes", tt.name, len(d))
+			}
+		}
+		lost := map[int]bool{}
+		for _, i := range tt.lost {
+			lost[i] = true
+		}
+		if got := reassemble(t, datagrams, lost); !bytes.Equal(got, frame) {
+			t.Errorf("%s: frame not restored after losing %v", tt.name, tt.lost)
+		}
+	}
+}
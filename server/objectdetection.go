@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"image"
 	"log"
+	"sync"
 
 	"gocv.io/x/gocv"
 )
@@ -22,10 +25,59 @@ type config struct {
 	Max     int     `json:"max"`
 }
 
-var circleDetectionConfig config
+// validate rejects configs OpenCV would abort on, the empty config selects the defaults
+func (cfg config) validate() error {
+	if cfg == (config{}) {
+		return nil
+	}
+	if cfg.Dp <= 0 || cfg.Mindist <= 0 || cfg.Param1 <= 0 || cfg.Param2 <= 0 {
+		return errors.New("dp, mindist, param1 and param2 must be positive")
+	}
+	if cfg.Min < 0 || cfg.Max < 0 || (cfg.Max > 0 && cfg.Max < cfg.Min) {
+		return errors.New("min and max radius must not be negative and max at least min, 0 for no max")
+	}
+	return nil
+}
+
+// circleDetection holds the detection config, it's replaced by handlers while
+// hub frames detect circles with it
+var circleDetection struct {
+	mutex   sync.RWMutex
+	config  config
+	version uint64 // counts changes of the config, payloads carry it in cv
+}
+
+// circleDetectionConfig returns the detection config and its version
+func circleDetectionConfig() (config, uint64) {
+	circleDetection.mutex.RLock()
+	defer circleDetection.mutex.RUnlock()
+	return circleDetection.config, circleDetection.version
+}
+
+// setCircleDetectionConfig replaces the detection config and tells event listeners
+func setCircleDetectionConfig(cfg config) {
+	circleDetection.mutex.Lock()
+	circleDetection.config = cfg
+	circleDetection.version++
+	circleDetection.mutex.Unlock()
+	events.publish("config", cfg)
+}
+
+// depthAt returns the depth array value at the centre of a circle, 0 if it
+// lies outside the frame
+func (c circle) depthAt(depth []byte) int {
+	if c.X < 0 || c.Y < 0 || c.X >= frameWidth || c.Y >= frameHeight || len(depth) < frameWidth*frameHeight {
+		return 0
+	}
+	return int(depth[c.Y*frameWidth+c.X])
+}
 
 func detectCircles(cfg config) []circle {
-	frame := freenect_device.RGBAFrame()
+	return detectCirclesIn(freenect_device.RGBAFrame(), cfg)
+}
+
+// detectCirclesIn detects the circles of an RGB frame already taken
+func detectCirclesIn(frame image.Image, cfg config) []circle {
 	img, err := gocv.ImageToMatRGBA(frame)
 	if err != nil {
 		log.Println(err)
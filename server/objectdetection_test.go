@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestCircleDepthAt(t *testing.T) {
+	depth := make([]byte, frameWidth*frameHeight)
+	depth[10*frameWidth+20] = 7
+	depth[frameWidth*frameHeight-1] = 9
+	tests := []struct {
+		c    circle
+		want int
+	}{
+		{circle{X: 20, Y: 10}, 7},
+		{circle{X: 10, Y: 20}, 0},
+		{circle{X: frameWidth - 1, Y: frameHeight - 1}, 9},
+		{circle{X: frameWidth, Y: 0}, 0},
+		{circle{X: 0, Y: frameHeight}, 0},
+		{circle{X: -1, Y: 5}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.c.depthAt(depth); got != tt.want {
+			t.Errorf("%+v: got %d, want %d", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := config{Dp: 1, Mindist: 60, Param1: 75, Param2: 20, Min: 4}
+	tests := []struct {
+		name string
+		cfg  config
+		ok   bool
+	}{
+		{"defaults", config{}, true},
+		{"valid", valid, true},
+		{"max radius", config{Dp: 1, Mindist: 60, Param1: 75, Param2: 20, Min: 4, Max: 40}, true},
+		{"dp 0", config{Mindist: 60, Param1: 75, Param2: 20}, false},
+		{"negative mindist", config{Dp: 1, Mindist: -1, Param1: 75, Param2: 20}, false},
+		{"param2 0", config{Dp: 1, Mindist: 60, Param1: 75}, false},
+		{"negative min", config{Dp: 1, Mindist: 60, Param1: 75, Param2: 20, Min: -1}, false},
+		{"min above max", config{Dp: 1, Mindist: 60, Param1: 75, Param2: 20, Min: 50, Max: 40}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
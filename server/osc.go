@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"time"
+)
+
+// maxOSCPacket keeps height grids below the UDP payload limit
+const maxOSCPacket = 60000
+
+// oscConfig is read from the file given with -osc
+type oscConfig struct {
+	Targets  []string `json:"targets"`  // host:port receivers
+	Interval int      `json:"interval"` // ms between height grids
+	Grid     int      `json:"grid"`     // grid step in pixels, 0 sends no grids
+	Base     float64  `json:"base"`     // distance camera to baseline in mm, 0 for the farthest point
+}
+
+func loadOSCConfig(path string) (oscConfig, error) {
+	cfg := oscConfig{Interval: 200, Grid: 16}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval < 1000/maxFPS {
+		cfg.Interval = 1000 / maxFPS
+	}
+	// float32 per cell plus the message header has to fit into one datagram
+	for cfg.Grid > 0 && ((frameWidth-1)/cfg.Grid+1)*((frameHeight-1)/cfg.Grid+1)*4 > maxOSCPacket-64 {
+		cfg.Grid++
+	}
+	return cfg, nil
+}
+
+// oscPad appends zero bytes up to the next multiple of four
+func oscPad(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func oscUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func oscString(b []byte, s string) []byte {
+	return oscPad(append(append(b, s...), 0))
+}
+
+// oscMessage encodes an OSC 1.0 message with int32 (i), float32 (f), string (s) and blob (b) arguments
+func oscMessage(address string, args ...interface{}) []byte {
+	tags := ","
+	var data []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			tags += "i"
+			data = oscUint32(data, uint32(int32(v)))
+		case float64:
+			tags += "f"
+			data = oscUint32(data, math.Float32bits(float32(v)))
+		case string:
+			tags += "s"
+			data = oscString(data, v)
+		case []byte:
+			tags += "b"
+			data = oscUint32(data, uint32(len(v)))
+			data = oscPad(append(data, v...))
+		default:
+			panic(fmt.Sprintf("osc: unsupported argument %T", arg))
+		}
+	}
+	return append(oscString(oscString(nil, address), tags), data...)
+}
+
+// oscCircle is /gosand/circle, /gosand/enter or /gosand/leave with id, x, y, z and r
+func oscCircle(address string, c trackedCircle) []byte {
+	return oscMessage(address, c.ID, float64(c.X), float64(c.Y), float64(c.Z), float64(c.R))
+}
+
+// oscGrid is /gosand/grid with width, height and a blob of big endian float32 heights in mm, row by row
+func oscGrid(h heightfield) []byte {
+	blob := make([]byte, 0, 4*len(h.Z))
+	for _, z := range h.Z {
+		blob = oscUint32(blob, math.Float32bits(float32(z)))
+	}
+	return oscMessage("/gosand/grid", h.Width, h.Height, blob)
+}
+
+// startOSC sends detections, events and height grids to all targets
+func startOSC(path string) error {
+	cfg, err := loadOSCConfig(path)
+	if err != nil {
+		return err
+	}
+	var targets []*net.UDPAddr
+	for _, t := range cfg.Targets {
+		addr, err := net.ResolveUDPAddr("udp", t)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, addr)
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	log.Println("Sending OSC to", cfg.Targets)
+	deviceUsers.enter()
+	go sendOSC(conn, targets, cfg)
+	return nil
+}
+
+func sendOSC(conn *net.UDPConn, targets []*net.UDPAddr, cfg oscConfig) {
+	defer deviceUsers.leave()
+	defer conn.Close()
+	send := func(packet []byte) {
+		for _, t := range targets {
+			if _, err := conn.WriteToUDP(packet, t); err != nil {
+				log.Println("OSC:", err)
+			}
+		}
+	}
+
+	queue := events.subscribe()
+	defer events.unsubscribe(queue)
+	ticks := make(chan *hubFrame, 1)
+	if cfg.Grid > 0 {
+		defer streamHub.unsubscribe(ticks)
+		streamHub.subscribe(ticks, time.Duration(cfg.Interval)*time.Millisecond)
+	}
+
+	for {
+		select {
+		case <-serverContext.Done():
+			return
+
+		case e := <-queue:
+			switch data := e.Data.(type) {
+			case []trackedCircle:
+				// all circles followed by their count, so receivers know the list is complete
+				for _, c := range data {
+					send(oscCircle("/gosand/circle", c))
+				}
+				send(oscMessage("/gosand/circles", len(data)))
+			case trackedCircle:
+				send(oscCircle("/gosand/"+e.Type, data))
+			default:
+				b, _ := json.Marshal(e.Data)
+				send(oscMessage("/gosand/event", e.Type, string(b)))
+			}
+
+		case f := <-ticks:
+			h := newHeightfield(f.depthArray16(), cfg.Base).Filled().Downsample(cfg.Grid)
+			send(oscGrid(h))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOSCPad(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"a", 4},
+		{"abc", 4},
+		{"abcd", 4},
+		{"abcde", 8},
+	}
+	for _, tt := range tests {
+		if got := oscPad([]byte(tt.in)); len(got) != tt.want || !bytes.HasPrefix(got, []byte(tt.in)) {
+			t.Errorf("oscPad(%q) = %q", tt.in, got)
+		}
+	}
+	// strings always end with at least one zero byte
+	for _, s := range []string{"", "abc", "abcd"} {
+		got := oscString(nil, s)
+		if len(got)%4 != 0 || len(got) <= len(s) || got[len(s)] != 0 {
+			t.Errorf("oscString(%q) = %q", s, got)
+		}
+	}
+}
+
+func TestOSCMessage(t *testing.T) {
+	tests := []struct {
+		address string
+		args    []interface{}
+		want    []byte
+	}{
+		{"/a", nil, []byte("/a\x00\x00,\x00\x00\x00")},
+		{"/gosand/x", []interface{}{1, -1}, []byte("/gosand/x\x00\x00\x00,ii\x00\x00\x00\x00\x01\xff\xff\xff\xff")},
+		{"/f", []interface{}{1.0}, []byte("/f\x00\x00,f\x00\x00\x3f\x80\x00\x00")},
+		{"/s", []interface{}{"hey"}, []byte("/s\x00\x00,s\x00\x00hey\x00")},
+		{"/b", []interface{}{[]byte{1, 2, 3, 4, 5}}, []byte("/b\x00\x00,b\x00\x00\x00\x00\x00\x05\x01\x02\x03\x04\x05\x00\x00\x00")},
+	}
+	for _, tt := range tests {
+		if got := oscMessage(tt.address, tt.args...); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s %v:\n got % x\nwant % x", tt.address, tt.args, got, tt.want)
+		}
+	}
+}
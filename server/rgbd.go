@@ -0,0 +1,179 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// cameraIntrinsics of the Kinect RGB camera which the registered depth frame is aligned to
+type cameraIntrinsics struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Fx         float64 `json:"fx"`
+	Fy         float64 `json:"fy"`
+	Cx         float64 `json:"cx"`
+	Cy         float64 `json:"cy"`
+	DepthScale float64 `json:"depth_scale"` // metres per depth unit
+}
+
+// kinectIntrinsics are the commonly used defaults for a Kinect for XBOX 360
+var kinectIntrinsics = cameraIntrinsics{
+	Width:      frameWidth,
+	Height:     frameHeight,
+	Fx:         525,
+	Fy:         525,
+	Cx:         319.5,
+	Cy:         239.5,
+	DepthScale: 0.001,
+}
+
+// depthImage16 returns millimetre depth as 16-bit greyscale image, invalid pixels are 0
+func depthImage16(depth []uint16) *image.Gray16 {
+	img := image.NewGray16(image.Rect(0, 0, frameWidth, frameHeight))
+	for i, d := range depth {
+		binary.BigEndian.PutUint16(img.Pix[2*i:], d)
+	}
+	return img
+}
+
+// writeNPY writes the depth frame as NumPy array of shape (480, 640),
+// uint16 millimetres or float32 millimetres with NaN for invalid pixels
+func writeNPY(w io.Writer, depth []uint16, float bool) error {
+	descr := "<u2"
+	if float {
+		descr = "<f4"
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%d, %d), }", descr, frameHeight, frameWidth)
+	// magic, version and header length take 10 bytes, the header ends with a newline
+	// and everything is padded to a multiple of 64 bytes
+	pad := 64 - (10+len(header)+1)%64
+	header += string(bytes.Repeat([]byte{' '}, pad%64)) + "\n"
+
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if !float {
+		return binary.Write(w, binary.LittleEndian, depth)
+	}
+	values := make([]float32, len(depth))
+	for i, d := range depth {
+		values[i] = float32(d)
+		if d == 0 {
+			values[i] = float32(math.NaN())
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, values)
+}
+
+// rgbdMeta describes a RGB-D bundle
+type rgbdMeta struct {
+	DepthTimestamp uint32           `json:"depth_timestamp"`
+	RGBTimestamp   uint32           `json:"rgb_timestamp"`
+	ServerTime     time.Time        `json:"server_time"`
+	DepthUnits     string           `json:"depth_units"`
+	Intrinsics     cameraIntrinsics `json:"intrinsics"`
+}
+
+// opaque sets the alpha channel of a RGBAFrame, which is left at 1 by the device
+func opaque(img *image.RGBA) *image.RGBA {
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func writeRGBD(w io.Writer, depth []uint16, rgb *image.RGBA, meta rgbdMeta) error {
+	z := zip.NewWriter(w)
+	f, err := z.Create("depth.png")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, depthImage16(depth)); err != nil {
+		return err
+	}
+	f, err = z.Create("rgb.png")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, opaque(rgb)); err != nil {
+		return err
+	}
+	f, err = z.Create("meta.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// GetDepth16 returns the depth frame as lossless 16-bit PNG in millimetres
+func GetDepth16(c *gin.Context) {
+	freenect_device.SetLed(freenect.LED_GREEN)
+	c.Writer.Header().Set("Content-Type", "image/png")
+	png.Encode(c.Writer, depthImage16(freenect_device.DepthArray16(false)))
+	freenect_device.SetLed(freenect.LED_OFF)
+}
+
+// GetNPY godoc
+// @Summary Get Depth as NumPy Array
+// @Description gets the depth frame in millimetres as .npy file with shape (480, 640)
+// @Produce  octet-stream
+// @Param dtype query string false "uint16 (default) or float32, float32 marks invalid pixels as NaN"
+// @Success 200 byte npy
+// @Router /export/depth.npy [get]
+func GetNPY(c *gin.Context) {
+	float := c.Request.URL.Query().Get("dtype") == "float32"
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+	depth := freenect_device.DepthArray16(false)
+	c.Writer.Header().Set("Content-Type", "application/octet-stream")
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand-depth.npy")
+	if err := writeNPY(c.Writer, depth, float); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetRGBD godoc
+// @Summary Get RGB-D Bundle
+// @Description gets a zip with 16-bit depth PNG, RGB PNG and meta.json holding intrinsics and timestamps
+// @Produce  octet-stream
+// @Success 200 byte zip
+// @Router /export/rgbd.zip [get]
+func GetRGBD(c *gin.Context) {
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+	depth, depthTimestamp := freenect_device.DepthArray16WithTimestamp(false)
+	rgb, rgbTimestamp := freenect_device.RGBAFrameWithTimestamp()
+	meta := rgbdMeta{
+		DepthTimestamp: depthTimestamp,
+		RGBTimestamp:   rgbTimestamp,
+		ServerTime:     time.Now(),
+		DepthUnits:     "mm",
+		Intrinsics:     kinectIntrinsics,
+	}
+	c.Writer.Header().Set("Content-Type", "application/zip")
+	c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand-rgbd.zip")
+	if err := writeRGBD(c.Writer, depth, rgb, meta); err != nil {
+		log.Println(err)
+	}
+}
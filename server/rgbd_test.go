@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNPY(t *testing.T) {
+	depth := make([]uint16, frameWidth*frameHeight)
+	depth[1] = 1234
+	tests := []struct {
+		float bool
+		descr string
+		size  int
+	}{
+		{false, "'descr': '<u2'", 2},
+		{true, "'descr': '<f4'", 4},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeNPY(&buf, depth, tt.float); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if string(b[:8]) != "\x93NUMPY\x01\x00" {
+			t.Fatalf("magic % x", b[:8])
+		}
+		n := int(binary.LittleEndian.Uint16(b[8:]))
+		header := string(b[10 : 10+n])
+		if (10+n)%64 != 0 || !strings.HasSuffix(header, "\n") {
+			t.Errorf("header of %d bytes not aligned to 64 or without newline", 10+n)
+		}
+		if !strings.Contains(header, tt.descr) || !strings.Contains(header, "'shape': (480, 640)") || !strings.Contains(header, "'fortran_order': False") {
+			t.Errorf("header %q", header)
+		}
+		data := b[10+n:]
+		if len(data) != tt.size*len(depth) {
+			t.Fatalf("%d data bytes", len(data))
+		}
+		if !tt.float {
+			if v := binary.LittleEndian.Uint16(data[2:]); v != 1234 {
+				t.Errorf("second value %d", v)
+			}
+			continue
+		}
+		first := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		second := math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))
+		if !math.IsNaN(float64(first)) || second != 1234 {
+			t.Errorf("values %v %v, want NaN 1234", first, second)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// drainTimeout is how long streams may take to close on shutdown before the
+// device is stopped anyway
+const drainTimeout = 5 * time.Second
+
+// serverContext is cancelled when the server stops accepting connections.
+// Streams, publishers and loops end with it.
+var serverContext, cancelServer = context.WithCancel(context.Background())
+
+// activity counts goroutines reading from the device outside of plain
+// requests, so the device is only stopped once they are done
+type activity struct {
+	mutex    sync.Mutex
+	count    int
+	stopping bool
+	idle     chan struct{}
+}
+
+var deviceUsers = &activity{}
+
+// enter starts new work, false once the server is shutting down
+func (a *activity) enter() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stopping {
+		return false
+	}
+	a.count++
+	return true
+}
+
+// join starts work on behalf of work that entered and hasn't left yet, it
+// can't be refused as the caller relies on it
+func (a *activity) join() {
+	a.mutex.Lock()
+	a.count++
+	a.mutex.Unlock()
+}
+
+func (a *activity) leave() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.count--
+	if a.count == 0 && a.idle != nil {
+		close(a.idle)
+		a.idle = nil
+	}
+}
+
+// stop refuses new work and waits until the running work has left or ctx is done
+func (a *activity) stop(ctx context.Context) error {
+	a.mutex.Lock()
+	a.stopping = true
+	if a.count == 0 {
+		a.mutex.Unlock()
+		return nil
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	idle := a.idle
+	a.mutex.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
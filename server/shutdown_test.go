@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// stopped runs stop in the background and returns its result channel
+func stopped(ctx context.Context, a *activity) chan error {
+	done := make(chan error, 1)
+	go func() { done <- a.stop(ctx) }()
+	return done
+}
+
+func TestActivityStop(t *testing.T) {
+	a := &activity{}
+	if !a.enter() || !a.enter() {
+		t.Fatal("work refused before stopping")
+	}
+	done := stopped(context.Background(), a)
+	time.Sleep(10 * time.Millisecond)
+
+	// stopping refuses new work but waits for the running work
+	for a.enter() {
+		a.leave()
+		time.Sleep(time.Millisecond)
+	}
+	a.leave()
+	// work of a stream still running can start on its behalf
+	a.join()
+	a.leave()
+	select {
+	case err := <-done:
+		t.Fatalf("stopped with work running: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	a.join()
+	a.leave()
+	a.leave()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not stopped after all work left")
+	}
+	if a.enter() {
+		t.Error("work entered after stopping")
+	}
+	// stopping again returns right away
+	if err := a.stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestActivityStopTimeout(t *testing.T) {
+	a := &activity{}
+	a.enter()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := <-stopped(ctx, a); err != context.DeadlineExceeded {
+		t.Errorf("stuck work: %v", err)
+	}
+	// the work can still leave later
+	a.leave()
+	if err := a.stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"image"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,20 +29,85 @@ type Client struct {
 	conn *websocket.Conn
 
 	// Buffered channels messages.
-	write  chan []byte // images and data to client
-	read   chan []byte // commands from client
-	closed bool        // closed by peer
+	out     *outbox        // images, data and replies to client
+	read    chan []byte    // commands from client
+	ticks   chan *hubFrame // latest frame of the hub
+	done    chan struct{}  // closed when the connection is gone
+	stopped chan struct{}  // closed when render returned, nobody reads commands anymore
+
+	// for the admin listing
+	id        int
+	ip        string
+	connected time.Time
+	mutex     sync.Mutex
+	settings  streamSettings // as of the last command
+}
+
+// message is a websocket message of type websocket.TextMessage or websocket.BinaryMessage.
+// Messages of a channel may be dropped for a newer one, others are always sent.
+type message struct {
+	kind    int
+	data    []byte
+	channel string
+	pulled  bool // last message answering a next command
 }
 
 type payload struct {
-	Depthframe []byte   `json:"d"`
-	Circles    []circle `json:"c"`
+	Channel string `json:"ch,omitempty"`
+	frameMeta
+	Depthframe []byte            `json:"d"`
+	Circles    []circle          `json:"c"`
+	Contours   []contourLine     `json:"l,omitempty"`
+	Channels   map[string][]byte `json:"f,omitempty"` // little endian float32 rasters, binary in msgpack and cbor, base64 in JSON
+}
+
+// units of d
+const (
+	unitsDepthArray = "mm8"  // low byte of the registered depth in mm, 0 where invalid
+	unitsJPEG       = "jpeg" // JPEG image
+)
+
+// frameMeta tells clients which frame a payload belongs to, so they can spot
+// frames they didn't get and match payloads of different channels
+type frameMeta struct {
+	Seq        uint64  `json:"seq,omitempty"` // frame, the same for all channels taken together
+	DeviceTime uint32  `json:"ts"`            // device timestamp of d, of the depth frame without d
+	Time       int64   `json:"t"`             // server time the frame was taken in ms since the epoch
+	Width      int     `json:"w,omitempty"`   // of d
+	Height     int     `json:"h,omitempty"`
+	Units      string  `json:"u,omitempty"`  // of d
+	Filter     uint32  `json:"fv,omitempty"` // filter version, changes with the filter and roi settings
+	Config     uint64  `json:"cv"`           // detection config version, counts config changes
+	Latency    float64 `json:"dl,omitempty"` // ms from taking the frame until its circles were detected
+}
+
+func newFrameMeta(taken time.Time, timestamp uint32) frameMeta {
+	_, version := circleDetectionConfig()
+	return frameMeta{
+		DeviceTime: timestamp,
+		Time:       taken.UnixNano() / int64(time.Millisecond),
+		Config:     version,
+	}
+}
+
+// describe sets size and units of d, cropped to the region of interest
+func (m *frameMeta) describe(roi []int, units string) {
+	m.Width, m.Height, m.Units = frameWidth, frameHeight, units
+	if roi != nil {
+		m.Width, m.Height = roi[2], roi[3]
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
 
 // streamReader reads messages from the websocket connection and fowards them to the read channel
 func (c *Client) streamReader() {
 	defer func() {
 		c.conn.Close()
+		streamClients.remove(c.id)
+		close(c.done)
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(readTimeout))
@@ -48,16 +118,21 @@ func (c *Client) streamReader() {
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
-				c.closed = true
 			}
 			break
 		}
-		// feed message to command channel
-		c.read <- message
+		// feed message to command channel, unless render is gone
+		select {
+		case c.read <- message:
+		case <-c.stopped:
+			return
+		case <-serverContext.Done():
+			return
+		}
 	}
 }
 
-// streamWriter writes messages from the write channel to the websocket connection
+// streamWriter writes messages from the outbox to the websocket connection
 func (c *Client) streamWriter() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -68,30 +143,18 @@ func (c *Client) streamWriter() {
 		// Go’s select lets you wait on multiple channel operations.
 		// We’ll use select to await both of these values simultaneously.
 		select {
-		case message, ok := <-c.write:
-			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			// NextWriter returns a writer for the next message to send.
-			// The writer's Close method flushes the complete message to the network.
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+		case <-c.out.ready:
+			for m, ok := c.out.pop(); ok; m, ok = c.out.pop() {
+				start := time.Now()
+				c.conn.SetWriteDeadline(start.Add(writeTimeout))
+				if err := c.conn.WriteMessage(m.kind, m.data); err != nil {
+					return
+				}
+				c.out.written(m, time.Since(start))
 			}
-			w.Write(message)
 
-			// Add queued messages to the current websocket message
-			n := len(c.write)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.write)
-			}
-
-			if err := w.Close(); err != nil {
-				return
-			}
+		case <-c.done:
+			return
 
 		//a channel that will send the time with a period specified by the duration argument
 		case <-ticker.C:
@@ -109,15 +172,34 @@ func (c *Client) streamWriter() {
 
 // ServeWebsocket godoc
 // @Summary Serves a websocket streaming kinect frames
-// @Description Serves frames continuously
+// @Description Serves frames continuously, multiplexing subscribed channels tagged by name in ch. The client can change the settings while streaming with JSON commands
+// @Description like {"cmd":"set","id":1,"interval":100,"type":"rgbframe","detection":true,"roi":[0,0,320,240],"filter":{"fill":true,"median":true,"temporal":0.5},"format":"msgpack",
+// @Description "change":{"on":true,"height":1,"pixel":5,"pixels":500,"circles":1,"heartbeat":5000}}
+// @Description {"cmd":"subscribe","channel":"rgb","interval":500}, {"cmd":"unsubscribe","channel":"frame"},
+// @Description {"cmd":"next","channels":["frame","rgb"],"format":"msgpack"} answered with one fresh message per channel after the reply
+// @Description or {"cmd":"get"}, each answered with {"reply":"set","id":1,"ok":true,"settings":{...}} or ok false and an error.
 // @Accept  json
-// @Produce  jpeg
-// @Param type path string true "Frame Type deptharray, depthframe, irframe, rgbframe"
-// @Param time path int true "Image sending frequency in ms"
+// @Produce  json
+// @Param time path int true "Image sending frequency in ms, 0 sends frames on next commands only"
+// @Param type query string false "Frame Type deptharray (default), depthframe, irframe, rgbframe, images are sent as JPEG in d"
+// @Param detection query string false "Enables circle detection if set"
+// @Param format query string false "json (text messages, default), msgpack, cbor or raw (binary messages, d behind a 32 byte header)"
+// @Param subscribe query string false "Additional channels with interval in ms, e.g. rgb:500,circles:100,events, of frame, depth, rgb, ir, circles, contours and events"
+// @Param contours query number false "Contour interval in mm, at least 1, contour lines are sent in l"
+// @Param channels query string false "Comma separated slope, aspect, profile, plan sent in f as float32 rasters, binary with msgpack and cbor"
+// @Param change query string false "Sends frames only when the sandbox changes if set, tuned with the change setting"
 // @Success 200 byte jpeg
-// @Router /stream/{type}/{time}/ [get]
+// @Failure 400 {object} string
+// @Router /stream/{time}/ [get]
 func ServeWebsocket(c *gin.Context) {
 
+	// invalid settings are refused before upgrading, like commands with an error reply
+	settings, err := streamSettingsFromQuery(c)
+	if err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+
 	// upgrade connection to websocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -126,26 +208,24 @@ func ServeWebsocket(c *gin.Context) {
 	}
 	conn.EnableWriteCompression(false)
 
-	// create two channels for read write concurrency
-	cWrite := make(chan []byte)
-	cRead := make(chan []byte)
-
-	client := &Client{conn: conn, write: cWrite, read: cRead, closed: false}
-
-	circleDetection := false
-	if c.Request.URL.Query().Get("detection") != "" {
-		circleDetection = true
+	// the read channel is buffered so a burst of commands doesn't block the reader
+	client := &Client{conn: conn, out: newOutbox(), read: make(chan []byte, 16), ticks: make(chan *hubFrame, 1), done: make(chan struct{}),
+		stopped: make(chan struct{}), ip: remoteIP(c), connected: time.Now()}
+	if !deviceUsers.enter() {
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	if client.id, err = streamClients.add(client.ip, client); err != nil {
+		deviceUsers.leave()
+		client.closeWith(websocket.CloseTryAgainLater, err.Error())
+		return
 	}
 
 	if freenect_device_present {
 		freenect_device.SetLed(freenect.LED_BLINK_RED_YELLOW)
 	}
 
-	wait_time, err := time.ParseDuration(c.Params.ByName("time") + "ms")
-	if err != nil {
-		wait_time, _ = time.ParseDuration("200ms")
-	}
-	go client.render(circleDetection, wait_time)
+	go client.render(settings)
 
 	// run reader and writer in two different go routines
 	// so they can act concurrently
@@ -153,31 +233,250 @@ func ServeWebsocket(c *gin.Context) {
 	go client.streamWriter()
 }
 
-func (c *Client) render(circleDetection bool, wait_time time.Duration) {
-	for {
-		depth_array := freenect_device.DepthArray(true)
-		var cs []circle
-		if circleDetection {
-			cs = detectCircles(circleDetectionConfig)
-			for i, circle := range cs {
-				depth := depth_array[int(circle.X*480+circle.Y)]
-				cs[i].Z = int(depth)
+// streamSettingsFromQuery returns the initial settings of a stream from its
+// path and query
+func streamSettingsFromQuery(c *gin.Context) (streamSettings, error) {
+	query := c.Request.URL.Query()
+	terrain, err := terrainOptionsFromQuery(c)
+	if err != nil {
+		return streamSettings{}, err
+	}
+	settings := streamSettings{
+		Channels:  map[string]int{channelFrame: 200},
+		Type:      "deptharray",
+		Detection: query.Get("detection") != "",
+		Filter:    depthFilter{Fill: true},
+		Format:    formatJSON,
+		Change:    defaultChangeMode,
+		Terrain:   terrain,
+	}
+	settings.Change.On = query.Get("change") != ""
+	if t := query.Get("type"); t != "" {
+		if err := settings.apply(command{Type: &t}); err != nil {
+			return settings, err
+		}
+	}
+	if f := query.Get("format"); f != "" {
+		if err := settings.apply(command{Format: &f}); err != nil {
+			return settings, err
+		}
+	}
+	ms, err := strconv.Atoi(c.Params.ByName("time"))
+	if err != nil {
+		return settings, fmt.Errorf("invalid time %q", c.Params.ByName("time"))
+	}
+	if ms == 0 {
+		// frames are pulled with next commands only
+		settings.unsubscribe(channelFrame)
+	} else if err := settings.apply(command{Interval: &ms}); err != nil {
+		return settings, err
+	}
+	for _, sub := range strings.Split(query.Get("subscribe"), ",") {
+		if sub == "" {
+			continue
+		}
+		name := strings.SplitN(sub, ":", 2)
+		ms := 200
+		if len(name) == 2 {
+			if ms, err = strconv.Atoi(name[1]); err != nil {
+				return settings, fmt.Errorf("invalid interval %q of channel %q", name[1], name[0])
 			}
 		}
-		p := payload{Depthframe: depth_array, Circles: cs}
-		b, err := json.Marshal(p)
-		if err != nil {
-			log.Println(err)
-		} else {
-			c.write <- b
+		if err := settings.subscribe(name[0], ms); err != nil {
+			return settings, err
 		}
-		time.Sleep(wait_time)
+	}
+	return settings, nil
+}
 
-		if c.closed {
-			if freenect_device_present {
-				freenect_device.SetLed(freenect.LED_OFF)
-			}
+// send queues a message for the writer without waiting, false if the connection is gone
+func (c *Client) send(m message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	c.out.push(m)
+	return true
+}
+
+// render sends each subscribed channel at its interval and events as they
+// happen, and runs the client's commands in between
+func (c *Client) render(settings streamSettings) {
+	defer func() {
+		// a reader blocked in ReadMessage fails on the closed connection
+		close(c.stopped)
+		c.conn.Close()
+	}()
+	defer deviceUsers.leave()
+	defer func() {
+		if freenect_device_present {
+			freenect_device.SetLed(freenect.LED_OFF)
+		}
+	}()
+	var eventQueue chan event
+	defer func() {
+		if eventQueue != nil {
+			events.unsubscribe(eventQueue)
+		}
+	}()
+	defer streamHub.unsubscribe(c.ticks)
+	due := map[string]time.Time{}
+	sent := map[string]*sentFrame{} // last frame per channel in change mode
+	var pulls []pullRequest         // next commands waiting for a fresh frame
+	numbers := map[string]uint64{}  // messages sent per channel, gaps are dropped ones
+	c.setSettings(settings)
+	for {
+		if _, ok := settings.Channels[channelEvents]; ok && eventQueue == nil {
+			eventQueue = events.subscribe()
+		} else if !ok && eventQueue != nil {
+			events.unsubscribe(eventQueue)
+			eventQueue = nil
+		}
+
+		// ask the hub for frames as fast as the fastest channel, slowed down if the
+		// client lags, or as fast as allowed while next commands wait
+		shortest := settings.shortestInterval()
+		slowdown := c.out.slowdown(shortest)
+		interval := time.Duration(float64(shortest) * slowdown)
+		if pullInterval := time.Duration(min_interval) * time.Millisecond; len(pulls) > 0 && (interval == 0 || interval > pullInterval) {
+			interval = pullInterval
+		}
+		streamHub.subscribe(c.ticks, interval)
+
+		select {
+		case <-c.done:
+			return
+
+		case <-serverContext.Done():
+			c.closeWith(websocket.CloseGoingAway, "server shutting down")
 			return
+
+		case cmd := <-c.read:
+			r := settings.handle(cmd)
+			c.setSettings(settings)
+			if r.OK && r.Reply == "set" {
+				// changed settings are sent right away
+				sent = map[string]*sentFrame{}
+			}
+			if r.OK && r.Reply == "stats" {
+				stats := c.out.statistics()
+				r.Stats = &stats
+			}
+			if r.pull != nil && len(pulls)+c.out.pendingPulls() >= maxPendingPulls {
+				r = reply{Reply: r.Reply, ID: r.ID, Error: fmt.Sprintf("at most %d next commands can be pending", maxPendingPulls)}
+			} else if r.pull != nil {
+				pulls = append(pulls, *r.pull)
+			}
+			b, err := json.Marshal(r)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !c.send(message{kind: websocket.TextMessage, data: b}) {
+				return
+			}
+
+		case e := <-eventQueue:
+			m, err := encodeMessage(settings.Format, eventMessage{Channel: channelEvents, event: e})
+			if err != nil {
+				log.Println(err)
+			} else if !c.send(m) {
+				return
+			}
+
+		case f := <-c.ticks:
+			now := f.taken
+			// frames already waiting when a next command came in are not fresh
+			for len(pulls) > 0 && !now.Before(pulls[0].after) {
+				messages, err := settings.pull(pulls[0], f, c.out.statistics())
+				if err != nil {
+					log.Println(err)
+					messages = []message{pulls[0].failed(err)}
+				}
+				for i, m := range messages {
+					m.pulled = i == len(messages)-1
+					if !c.send(m) {
+						return
+					}
+				}
+				pulls = pulls[1:]
+			}
+			snap := &snapshot{s: &settings, f: f}
+			for name, ms := range settings.Channels {
+				// hub ticks jitter a little, a channel is due if it's nearly time
+				if name == channelEvents || now.Add(time.Second/maxFPS/2).Before(due[name]) {
+					continue
+				}
+				// in change mode unchanged frames are skipped, the schedule is kept
+				send := true
+				if settings.Change.On && name != channelStats {
+					var next *sentFrame
+					if next, send = settings.Change.changed(sent[name], snap, settings.Detection || name == channelCircles); send {
+						sent[name] = next
+					} else {
+						c.out.skipped()
+					}
+				}
+				if send {
+					var m message
+					var err error
+					if name == channelStats {
+						m, err = encodeMessage(settings.Format, statsMessage{Channel: channelStats, streamStats: c.out.statistics()})
+					} else {
+						m, err = settings.channel(name, snap)
+					}
+					if err == nil {
+						m, err = numbered(settings.Format, m, numbers[name]+1)
+					}
+					if err != nil {
+						log.Println(err)
+					} else {
+						numbers[name]++
+						m.channel = name
+						if !c.send(m) {
+							return
+						}
+					}
+				}
+				// keep the schedule unless the client fell behind by more than an interval
+				interval := time.Duration(float64(ms)*slowdown) * time.Millisecond
+				if due[name].IsZero() || now.Sub(due[name]) > interval {
+					due[name] = now.Add(interval)
+				} else {
+					due[name] = due[name].Add(interval)
+				}
+			}
 		}
 	}
 }
+
+// inROI reports whether a frame pixel lies inside the region of interest, nil is the full frame
+func inROI(roi []int, x, y int) bool {
+	return roi == nil || (x >= roi[0] && y >= roi[1] && x < roi[0]+roi[2] && y < roi[1]+roi[3])
+}
+
+// cropArray cuts the region of interest out of a 640x480 array
+func cropArray(a []byte, roi []int) []byte {
+	if roi == nil {
+		return a
+	}
+	cropped := make([]byte, 0, roi[2]*roi[3])
+	for y := roi[1]; y < roi[1]+roi[3]; y++ {
+		cropped = append(cropped, a[y*frameWidth+roi[0]:y*frameWidth+roi[0]+roi[2]]...)
+	}
+	return cropped
+}
+
+// cropImage cuts the region of interest out of a frame image
+func cropImage(img image.Image, roi []int) image.Image {
+	if roi == nil {
+		return img
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(image.Rect(roi[0], roi[1], roi[0]+roi[2], roi[1]+roi[3]))
+	}
+	return img
+}
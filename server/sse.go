@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ssePing keeps proxies from closing idle event streams
+const ssePing = 15 * time.Second
+
+// deviceStatus is sent to every event stream when it connects
+type deviceStatus struct {
+	Present bool `json:"present"`
+}
+
+// ServeEvents godoc
+// @Summary Serves server events as Server-Sent Events
+// @Description Streams circles (all tracked circles whenever they change), enter and leave (single objects), config (changed detection config) and device events.
+// @Description A reconnecting client resumes after the Last-Event-ID header from an in-memory log of the latest 1000 events.
+// @Produce  text/event-stream
+// @Param types query string false "Comma separated event types to send, default all"
+// @Param lastEventId query int false "Resume after this event id if the Last-Event-ID header can't be set"
+// @Success 200 {object} event
+// @Failure 503 {object} string
+// @Router /events [get]
+func ServeEvents(c *gin.Context) {
+	lastID := events.lastID()
+	resumeID := c.GetHeader("Last-Event-ID")
+	if resumeID == "" {
+		resumeID = c.Request.URL.Query().Get("lastEventId")
+	}
+	if id, err := strconv.ParseUint(resumeID, 10, 64); err == nil {
+		lastID = id
+	}
+	types := map[string]bool{}
+	for _, t := range strings.Split(c.Request.URL.Query().Get("types"), ",") {
+		if t != "" {
+			types[t] = true
+		}
+	}
+
+	client := newEndpointClient(kindEvents)
+	id, err := streamClients.add(remoteIP(c), client)
+	if err != nil {
+		c.JSON(503, err.Error())
+		return
+	}
+	defer streamClients.remove(id)
+
+	conn, rw, err := hijackStream(c, "text/event-stream")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+
+	missed, queue := events.resume(lastID)
+	defer events.unsubscribe(queue)
+
+	status, _ := json.Marshal(deviceStatus{Present: freenect_device_present})
+	fmt.Fprintf(rw, "retry: 3000\nevent: device\ndata: %s\n\n", status)
+	write := func(e event) error {
+		if len(types) > 0 && !types[e.Type] {
+			return nil
+		}
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		return err
+	}
+	for _, e := range missed {
+		if err := write(e); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	// the client never sends anything, reading only notices when it is gone
+	conn.SetReadDeadline(time.Time{})
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		rw.Reader.WriteTo(ioutil.Discard)
+	}()
+
+	ping := time.NewTicker(ssePing)
+	defer ping.Stop()
+	for {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := rw.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-gone:
+			return
+		case <-client.done:
+			return
+		case <-serverContext.Done():
+			return
+		case e := <-queue:
+			if err := write(e); err != nil {
+				log.Println(err)
+				return
+			}
+		case <-ping.C:
+			rw.WriteString(": ping\n\n")
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// The frame is placed into a square world as wide as the frame, rows below the
+// frame are flat at the lowest height. Zoom level z splits it into 2^z x 2^z tiles.
+const (
+	maxTileZoom   = 3
+	tileSize      = 256 // terrain-RGB pixels per tile side
+	tileGridSize  = 65  // quantized-mesh RTIN grid per tile side at every zoom level
+	tileCacheTime = time.Second
+)
+
+// tileCache shares one heightfield between the many tile requests of a map view
+var tileCache struct {
+	mutex sync.Mutex
+	h     heightfield
+	base  float64
+	taken time.Time
+}
+
+func cachedHeightfield(base float64) heightfield {
+	tileCache.mutex.Lock()
+	defer tileCache.mutex.Unlock()
+	if tileCache.h.Z == nil || tileCache.base != base || time.Since(tileCache.taken) > tileCacheTime {
+		tileCache.h = newHeightfield(freenect_device.DepthArray16(false), base).Filled()
+		tileCache.base = base
+		tileCache.taken = time.Now()
+	}
+	return tileCache.h
+}
+
+// tile addresses a quadtree tile in XYZ scheme, y grows southwards
+type tile struct {
+	Z, X, Y int
+}
+
+// span returns the tile side in frame pixels
+func (t tile) span() float64 {
+	return frameWidth / math.Exp2(float64(t.Z))
+}
+
+// sample returns the height at tile coordinates u (east) and v (south) in [0,1],
+// floor below the frame
+func (t tile) sample(h heightfield, floor, u, v float64) float64 {
+	s := t.span()
+	fx, fy := (float64(t.X)+u)*s, (float64(t.Y)+v)*s
+	if fy > float64(h.Height-1) {
+		return floor
+	}
+	return h.Sample(fx, fy)
+}
+
+// terrainRGB encodes heights in mm with the Mapbox terrain-RGB formula
+// height = -10000 + (R * 256 * 256 + G * 256 + B) * 0.1
+func terrainRGB(h heightfield, t tile) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	floor, _ := h.Range()
+	for py := 0; py < tileSize; py++ {
+		for px := 0; px < tileSize; px++ {
+			z := t.sample(h, floor, (float64(px)+0.5)/tileSize, (float64(py)+0.5)/tileSize)
+			v := uint32(math.Max(0, math.Round((z+10000)/0.1)))
+			img.SetRGBA(px, py, color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff})
+		}
+	}
+	return img
+}
+
+// quantizedMeshHeader is the header of a quantized-mesh-1.0 tile. There is no
+// georeference, so it is filled in a local frame in metres instead of ECEF.
+type quantizedMeshHeader struct {
+	CenterX, CenterY, CenterZ         float64
+	MinimumHeight, MaximumHeight      float32
+	SphereX, SphereY, SphereZ, Radius float64
+	HorizonX, HorizonY, HorizonZ      float64
+}
+
+func zigZag(v int32) uint16 {
+	return uint16((v << 1) ^ (v >> 31))
+}
+
+// writeQuantizedMesh writes a tile in Cesium's quantized-mesh-1.0 format. The
+// mesh is the RTIN of the tile within maxError mm, which doubles with every
+// coarser zoom level, so lower levels cover more sand with fewer triangles.
+func writeQuantizedMesh(w io.Writer, h heightfield, t tile, cellsize, maxError float64) error {
+	n := tileGridSize
+	floor, _ := h.Range()
+	min, max := math.Inf(1), math.Inf(-1)
+	r := newRTIN(n, func(i, j int) float64 { // rows north to south
+		z := t.sample(h, floor, float64(i)/float64(n-1), float64(j)/float64(n-1))
+		min, max = math.Min(min, z), math.Max(max, z)
+		return z
+	})
+
+	// local frame in metres, x east and y north of the world's upper left corner
+	s := t.span() * cellsize / 1000
+	cx, cy := (float64(t.X)+0.5)*s, -(float64(t.Y)+0.5)*s
+	cz := (min + max) / 2000
+	header := quantizedMeshHeader{
+		CenterX: cx, CenterY: cy, CenterZ: cz,
+		MinimumHeight: float32(min / 1000), MaximumHeight: float32(max / 1000),
+		SphereX: cx, SphereY: cy, SphereZ: cz,
+		Radius:   math.Sqrt(s*s/2 + math.Pow((max-min)/2000, 2)),
+		HorizonX: cx, HorizonY: cy, HorizonZ: cz,
+	}
+
+	// vertices are numbered in order of first use as required by the high
+	// water mark index encoding
+	remap := make([]int, n*n)
+	for k := range remap {
+		remap[k] = -1
+	}
+	var order, triangles []int
+	r.triangles(maxError*math.Exp2(float64(maxTileZoom-t.Z)), func(ax, ay, bx, by, cx, cy int) {
+		for _, g := range []int{ay*n + ax, by*n + bx, cy*n + cx} {
+			if remap[g] < 0 {
+				remap[g] = len(order)
+				order = append(order, g)
+			}
+			triangles = append(triangles, remap[g])
+		}
+	})
+
+	bw := bufio.NewWriter(w)
+	binary.Write(bw, binary.LittleEndian, header)
+	binary.Write(bw, binary.LittleEndian, uint32(len(order)))
+
+	quantize := func(value func(g int) float64) {
+		var prev int32
+		for _, g := range order {
+			q := int32(math.Round(value(g) * 32767))
+			binary.Write(bw, binary.LittleEndian, zigZag(q-prev))
+			prev = q
+		}
+	}
+	quantize(func(g int) float64 { return float64(g%n) / float64(n-1) })
+	quantize(func(g int) float64 { return 1 - float64(g/n)/float64(n-1) })
+	quantize(func(g int) float64 {
+		if max == min {
+			return 0
+		}
+		return (r.z[g] - min) / (max - min)
+	})
+
+	binary.Write(bw, binary.LittleEndian, uint32(len(triangles)/3))
+	highest := 0
+	for _, idx := range triangles {
+		binary.Write(bw, binary.LittleEndian, uint16(highest-idx))
+		if idx == highest {
+			highest++
+		}
+	}
+
+	// edge vertices west, south, east, north
+	var west, south, east, north []uint16
+	for k := 0; k < n; k++ {
+		for _, e := range []struct {
+			list *[]uint16
+			g    int
+		}{{&west, k * n}, {&south, (n-1)*n + k}, {&east, k*n + n - 1}, {&north, k}} {
+			if remap[e.g] >= 0 {
+				*e.list = append(*e.list, uint16(remap[e.g]))
+			}
+		}
+	}
+	for _, e := range [][]uint16{west, south, east, north} {
+		binary.Write(bw, binary.LittleEndian, uint32(len(e)))
+		binary.Write(bw, binary.LittleEndian, e)
+	}
+	return bw.Flush()
+}
+
+// parseTile reads z, x and y.ext from the route
+func parseTile(c *gin.Context) (tile, string, bool) {
+	y := c.Params.ByName("y")
+	ext := path.Ext(y)
+	var t tile
+	var err [3]error
+	t.Z, err[0] = strconv.Atoi(c.Params.ByName("z"))
+	t.X, err[1] = strconv.Atoi(c.Params.ByName("x"))
+	t.Y, err[2] = strconv.Atoi(strings.TrimSuffix(y, ext))
+	for _, e := range err {
+		if e != nil {
+			return t, ext, false
+		}
+	}
+	tiles := 1 << uint(t.Z)
+	if t.Z < 0 || t.Z > maxTileZoom || t.X < 0 || t.Y < 0 || t.X >= tiles || t.Y >= tiles {
+		return t, ext, false
+	}
+	return t, ext, true
+}
+
+// GetTile godoc
+// @Summary Get Terrain Tile
+// @Description gets a quadtree tile of the heightfield as terrain-RGB PNG (heights in mm) or quantized-mesh-1.0 encoded RTIN (local frame in m, not georeferenced, no layer.json), zoom 0 to 3 in XYZ scheme
+// @Produce  png
+// @Param z path int true "Zoom level"
+// @Param x path int true "Tile column"
+// @Param y path string true "Tile row with extension .png or .terrain"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Param cellsize query number false "quantized-mesh only: pixel size on the sand in mm, default 1.7"
+// @Param error query number false "quantized-mesh only: max height error in mm at zoom 3, doubled per coarser level, default 2"
+// @Success 200 byte tile
+// @Failure 404 {object} string
+// @Router /tiles/{z}/{x}/{y} [get]
+func GetTile(c *gin.Context) {
+	t, ext, ok := parseTile(c)
+	if !ok || (ext != ".png" && ext != ".terrain") {
+		c.Data(404, "", nil)
+		return
+	}
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+	h := cachedHeightfield(queryFloat(c, "base", 0))
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	if ext == ".png" {
+		c.Writer.Header().Set("Content-Type", "image/png")
+		png.Encode(c.Writer, terrainRGB(h, t))
+		return
+	}
+	c.Writer.Header().Set("Content-Type", "application/vnd.quantized-mesh")
+	if err := writeQuantizedMesh(c.Writer, h, t, queryFloat(c, "cellsize", 1.7), queryFloat(c, "error", 2)); err != nil {
+		log.Println(err)
+	}
+}
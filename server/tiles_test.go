@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// quantizedMesh is a decoded quantized-mesh-1.0 tile
+type quantizedMesh struct {
+	header                   quantizedMeshHeader
+	u, v, height             []int
+	triangles                []int
+	west, south, east, north []int
+}
+
+func decodeQuantizedMesh(t *testing.T, b []byte) quantizedMesh {
+	r := bytes.NewReader(b)
+	var m quantizedMesh
+	binary.Read(r, binary.LittleEndian, &m.header)
+	var count uint32
+	binary.Read(r, binary.LittleEndian, &count)
+	for _, values := range []*[]int{&m.u, &m.v, &m.height} {
+		deltas := make([]uint16, count)
+		binary.Read(r, binary.LittleEndian, deltas)
+		value := 0
+		for _, d := range deltas {
+			value += int(int16(d>>1) ^ -int16(d&1))
+			*values = append(*values, value)
+		}
+	}
+	binary.Read(r, binary.LittleEndian, &count)
+	indices := make([]uint16, count*3)
+	binary.Read(r, binary.LittleEndian, indices)
+	highest := 0
+	for _, code := range indices {
+		m.triangles = append(m.triangles, highest-int(code))
+		if code == 0 {
+			highest++
+		}
+	}
+	for _, edge := range []*[]int{&m.west, &m.south, &m.east, &m.north} {
+		binary.Read(r, binary.LittleEndian, &count)
+		e := make([]uint16, count)
+		binary.Read(r, binary.LittleEndian, e)
+		for _, idx := range e {
+			*edge = append(*edge, int(idx))
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left after the tile", r.Len())
+	}
+	return m
+}
+
+// hill returns a heightfield with a smooth hill in the upper left quarter
+func hill() heightfield {
+	h := heightfield{Width: frameWidth, Height: frameHeight, Z: make([]float64, frameWidth*frameHeight)}
+	for y := 0; y < frameHeight; y++ {
+		for x := 0; x < frameWidth; x++ {
+			d := math.Hypot(float64(x-160), float64(y-120))
+			h.Z[y*frameWidth+x] = 100 * math.Cos(math.Min(d, 100)/100*math.Pi/2)
+		}
+	}
+	return h
+}
+
+func TestQuantizedMesh(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       heightfield
+		tile    tile
+		error   float64
+		flat    bool // two triangles only
+		maxTris int
+	}{
+		{"flat", testHeightfield(10).Filled(), tile{3, 1, 1}, 2, true, 2},
+		{"away from the hill", hill(), tile{1, 1, 1}, 2, true, 2},
+		{"below the frame", hill(), tile{2, 0, 3}, 0, true, 2},
+		{"hill coarse", hill(), tile{0, 0, 0}, 2, false, 2000},
+		{"hill fine", hill(), tile{3, 1, 1}, 0.5, false, 8192},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeQuantizedMesh(&buf, tt.h, tt.tile, 1.7, tt.error); err != nil {
+			t.Fatal(err)
+		}
+		m := decodeQuantizedMesh(t, buf.Bytes())
+		tris := len(m.triangles) / 3
+		if tt.flat != (tris == 2) || tris > tt.maxTris {
+			t.Errorf("%s: %d triangles", tt.name, tris)
+		}
+		for i := 0; i < len(m.triangles); i += 3 {
+			a, b, c := m.triangles[i], m.triangles[i+1], m.triangles[i+2]
+			cross := (m.u[b]-m.u[a])*(m.v[c]-m.v[a]) - (m.v[b]-m.v[a])*(m.u[c]-m.u[a])
+			if cross <= 0 {
+				t.Errorf("%s: triangle %d is not counter-clockwise", tt.name, i/3)
+				break
+			}
+		}
+		edges := []struct {
+			name    string
+			indices []int
+			coord   []int
+			value   int
+		}{{"west", m.west, m.u, 0}, {"south", m.south, m.v, 0}, {"east", m.east, m.u, 32767}, {"north", m.north, m.v, 32767}}
+		for _, e := range edges {
+			if len(e.indices) < 2 {
+				t.Errorf("%s: %d %s edge vertices", tt.name, len(e.indices), e.name)
+			}
+			for _, idx := range e.indices {
+				if e.coord[idx] != e.value {
+					t.Errorf("%s: vertex %d is not on the %s edge", tt.name, idx, e.name)
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizedMeshError(t *testing.T) {
+	// the same tile gets fewer triangles the larger the error
+	h := hill()
+	last := math.MaxInt32
+	for _, e := range []float64{0.25, 1, 4, 16} {
+		var buf bytes.Buffer
+		writeQuantizedMesh(&buf, h, tile{2, 0, 0}, 1.7, e)
+		tris := len(decodeQuantizedMesh(t, buf.Bytes()).triangles) / 3
+		if tris >= last {
+			t.Errorf("error %v: %d triangles, not fewer than %d", e, tris, last)
+		}
+		last = tris
+	}
+}
+
+func TestTerrainRGB(t *testing.T) {
+	for _, z := range []float64{-50, 0, 12.3, 6553.5} {
+		img := terrainRGB(testHeightfield(z).Filled(), tile{0, 0, 0})
+		p := img.RGBAAt(10, 10)
+		got := -10000 + float64(int(p.R)<<16|int(p.G)<<8|int(p.B))*0.1
+		if math.Abs(got-z) > 0.05 {
+			t.Errorf("height %v decoded as %v", z, got)
+		}
+	}
+}
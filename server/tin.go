@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/moethu/gosand/server/freenect"
+)
+
+// The TIN is refined on a right triangulated irregular network (RTIN) over a
+// square grid of 2^k+1 samples stretched across the frame. Triangles are split
+// along their hypotenuse only where the vertical error exceeds the limit, so
+// flat sand ends up with a few large triangles and the mesh stays crack free.
+const tinGridSize = 513
+
+// rtinCoords holds the hypotenuse end points ax, ay, bx, by of every triangle of
+// the full RTIN hierarchy by grid size, coarse triangles first
+var rtinCoords = map[int][]uint16{}
+var rtinCoordsMutex sync.Mutex
+
+func rtinTriangles(gridSize int) []uint16 {
+	rtinCoordsMutex.Lock()
+	defer rtinCoordsMutex.Unlock()
+	if coords, ok := rtinCoords[gridSize]; ok {
+		return coords
+	}
+	size := gridSize - 1
+	count := size*size*2 - 2
+	coords := make([]uint16, count*4)
+	for i := 0; i < count; i++ {
+		id := i + 2
+		var ax, ay, bx, by, cx, cy int
+		if id&1 == 1 {
+			bx, by, cx = size, size, size // bottom left triangle
+		} else {
+			ax, ay, cy = size, size, size // top right triangle
+		}
+		for id >>= 1; id > 1; id >>= 1 {
+			mx, my := (ax+bx)>>1, (ay+by)>>1
+			if id&1 == 1 { // left half
+				bx, by, ax, ay = ax, ay, cx, cy
+			} else { // right half
+				ax, ay, bx, by = bx, by, cx, cy
+			}
+			cx, cy = mx, my
+		}
+		coords[i*4], coords[i*4+1] = uint16(ax), uint16(ay)
+		coords[i*4+2], coords[i*4+3] = uint16(bx), uint16(by)
+	}
+	rtinCoords[gridSize] = coords
+	return coords
+}
+
+// rtin holds the heights sampled on a grid of size 2^k+1 and the largest error
+// introduced by leaving out each grid point
+type rtin struct {
+	size   int
+	z      []float64
+	errors []float64
+}
+
+// newRTIN samples the height of every grid column i and row j
+func newRTIN(size int, sample func(i, j int) float64) rtin {
+	n := size
+	r := rtin{size: n, z: make([]float64, n*n), errors: make([]float64, n*n)}
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			r.z[j*n+i] = sample(i, j)
+		}
+	}
+
+	coords := rtinTriangles(n)
+	count := len(coords) / 4
+	parents := count - (n-1)*(n-1)
+	for i := count - 1; i >= 0; i-- {
+		ax, ay := int(coords[i*4]), int(coords[i*4+1])
+		bx, by := int(coords[i*4+2]), int(coords[i*4+3])
+		mx, my := (ax+bx)>>1, (ay+by)>>1
+		cx, cy := mx+my-ay, my+ax-mx
+		m := my*n + mx
+		e := math.Abs((r.z[ay*n+ax]+r.z[by*n+bx])/2 - r.z[m])
+		r.errors[m] = math.Max(r.errors[m], e)
+		if i < parents {
+			left := ((ay+cy)>>1)*n + (ax+cx)>>1
+			right := ((by+cy)>>1)*n + (bx+cx)>>1
+			r.errors[m] = math.Max(r.errors[m], math.Max(r.errors[left], r.errors[right]))
+		}
+	}
+	return r
+}
+
+// triangles passes the grid corners of every triangle of the coarsest mesh
+// within maxError to emit, in the order of the grid they are counter-clockwise
+// with rows growing upwards
+func (r rtin) triangles(maxError float64, emit func(ax, ay, bx, by, cx, cy int)) {
+	n := r.size
+	var split func(ax, ay, bx, by, cx, cy int)
+	split = func(ax, ay, bx, by, cx, cy int) {
+		mx, my := (ax+bx)>>1, (ay+by)>>1
+		if abs(ax-cx)+abs(ay-cy) > 1 && r.errors[my*n+mx] > maxError {
+			split(cx, cy, ax, ay, mx, my)
+			split(bx, by, cx, cy, mx, my)
+			return
+		}
+		emit(ax, ay, bx, by, cx, cy)
+	}
+	max := n - 1
+	split(0, 0, max, max, max, 0)
+	split(max, max, 0, 0, 0, max)
+}
+
+// tinGrid is the RTIN of a frame heightfield
+type tinGrid struct {
+	rtin
+	h heightfield // source in frame pixels
+}
+
+func newTinGrid(h heightfield) tinGrid {
+	g := tinGrid{h: h}
+	g.rtin = newRTIN(tinGridSize, func(i, j int) float64 { return h.Sample(g.pixel(i, j)) })
+	return g
+}
+
+// pixel returns the frame position of grid column i and row j
+func (g tinGrid) pixel(i, j int) (float64, float64) {
+	n := float64(tinGridSize - 1)
+	return float64(i) * float64(g.h.Width-1) / n, float64(j) * float64(g.h.Height-1) / n
+}
+
+// changed reports whether any grid height moved by more than maxError since prev
+func (g tinGrid) changed(prev tinGrid, maxError float64) bool {
+	if prev.z == nil {
+		return true
+	}
+	for i, z := range g.z {
+		if math.Abs(z-prev.z[i]) > maxError {
+			return true
+		}
+	}
+	return false
+}
+
+// tin is a triangulated irregular network, vertices x and y in mm with rows
+// flipped like the STL export, z the height in mm
+type tin struct {
+	Vertices []vec3     `json:"vertices"`
+	Faces    [][3]int32 `json:"faces"`
+}
+
+// mesh extracts the coarsest TIN within maxError, faces counter-clockwise seen from above
+func (g tinGrid) mesh(maxError, pitch float64) tin {
+	n := tinGridSize
+	indices := make([]int32, n*n)
+	var t tin
+	vertex := func(x, y int) int32 {
+		k := y*n + x
+		if indices[k] == 0 {
+			fx, fy := g.pixel(x, y)
+			t.Vertices = append(t.Vertices, vec3{
+				float32(fx * pitch),
+				float32((float64(g.h.Height-1) - fy) * pitch),
+				float32(g.z[k]),
+			})
+			indices[k] = int32(len(t.Vertices))
+		}
+		return indices[k] - 1
+	}
+	g.triangles(maxError, func(ax, ay, bx, by, cx, cy int) {
+		t.Faces = append(t.Faces, [3]int32{vertex(ax, ay), vertex(bx, by), vertex(cx, cy)})
+	})
+	return t
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// writeTIN writes the TIN little endian as uint32 vertex count, float32 x, y, z
+// per vertex, uint32 face count and uint32 vertex indices per face
+func writeTIN(w io.Writer, t tin) error {
+	bw := bufio.NewWriter(w)
+	binary.Write(bw, binary.LittleEndian, uint32(len(t.Vertices)))
+	binary.Write(bw, binary.LittleEndian, t.Vertices)
+	binary.Write(bw, binary.LittleEndian, uint32(len(t.Faces)))
+	for _, f := range t.Faces {
+		binary.Write(bw, binary.LittleEndian, [3]uint32{uint32(f[0]), uint32(f[1]), uint32(f[2])})
+	}
+	return bw.Flush()
+}
+
+// tinOptionsFromQuery reads the error limit and the pixel size
+func tinOptionsFromQuery(c *gin.Context) (float64, float64) {
+	maxError := queryFloat(c, "error", 2)
+	if maxError < 0 {
+		maxError = 0
+	}
+	return maxError, queryFloat(c, "pitch", 1.7)
+}
+
+// GetTIN godoc
+// @Summary Get simplified TIN mesh
+// @Description gets the current heightfield as triangulated irregular network within a max vertical error, as JSON vertices/faces or binary
+// @Produce  json
+// @Param format path string true "json or bin"
+// @Param error query number false "Max vertical error in mm, default 2"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Param pitch query number false "Size of a pixel on the sand in mm, default 1.7"
+// @Success 200 {object} tin
+// @Router /export/tin.{format} [get]
+func GetTIN(c *gin.Context) {
+	freenect_device.SetLed(freenect.LED_GREEN)
+	defer freenect_device.SetLed(freenect.LED_OFF)
+
+	maxError, pitch := tinOptionsFromQuery(c)
+	t := newTinGrid(captureHeightfield(c).Filled()).mesh(maxError, pitch)
+	if path.Ext(c.Request.URL.Path) == ".bin" {
+		c.Writer.Header().Set("Content-Type", "application/octet-stream")
+		c.Writer.Header().Set("Content-Disposition", "attachment; filename=gosand.tin")
+		if err := writeTIN(c.Writer, t); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	c.JSON(200, t)
+}
+
+// ServeTIN godoc
+// @Summary Serves a websocket streaming the simplified TIN mesh
+// @Description Sends a new TIN whenever the sand moved by more than the error limit, checked every interval
+// @Produce  json
+// @Param error query number false "Max vertical error in mm, default 2"
+// @Param base query number false "Distance camera to baseline in mm, default farthest point"
+// @Param pitch query number false "Size of a pixel on the sand in mm, default 1.7"
+// @Param interval query int false "Check interval in ms, default 500, at least min_interval"
+// @Param format query string false "json (text messages, default) or bin (binary messages)"
+// @Failure 400 {object} string
+// @Router /tin/stream/ [get]
+func ServeTIN(c *gin.Context) {
+	maxError, pitch := tinOptionsFromQuery(c)
+	base := queryFloat(c, "base", 0)
+	binaryFormat := c.Request.URL.Query().Get("format") == "bin"
+	ms := queryInt(c, "interval", 500)
+	if err := validInterval(ms); err != nil {
+		c.JSON(400, err.Error())
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+	closeWith := func(code int, reason string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+	}
+	if !deviceUsers.enter() {
+		closeWith(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer deviceUsers.leave()
+	client := newEndpointClient(kindTIN)
+	id, err := streamClients.add(remoteIP(c), client)
+	if err != nil {
+		closeWith(websocket.CloseTryAgainLater, err.Error())
+		return
+	}
+	defer streamClients.remove(id)
+
+	// the client does not send anything, reading only notices when it is gone
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(ms) * time.Millisecond)
+	defer ticker.Stop()
+	var sent tinGrid
+	for {
+		depth, _ := deviceDepth16()
+		g := newTinGrid(newHeightfield(depth, base).Filled())
+		if g.changed(sent, maxError) {
+			t := g.mesh(maxError, pitch)
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if binaryFormat {
+				w, err := conn.NextWriter(websocket.BinaryMessage)
+				if err != nil {
+					return
+				}
+				writeTIN(w, t)
+				err = w.Close()
+			} else {
+				var b []byte
+				if b, err = json.Marshal(t); err == nil {
+					err = conn.WriteMessage(websocket.TextMessage, b)
+				}
+			}
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			sent = g
+		}
+		select {
+		case <-done:
+			return
+		case <-client.done:
+			closeWith(websocket.ClosePolicyViolation, "disconnected by admin")
+			return
+		case <-serverContext.Done():
+			closeWith(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
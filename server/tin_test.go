@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestRTINError(t *testing.T) {
+	const n = 65
+	wave := func(i, j int) float64 { return 20*math.Sin(float64(i)/7)*math.Cos(float64(j)/11) + float64(i)/3 }
+	r := newRTIN(n, wave)
+	last := math.MaxInt32
+	for _, maxError := range []float64{0, 0.5, 2, 8, 100} {
+		// the triangles cover the grid without gaps or overlaps, and none of
+		// them leaves out a hypotenuse midpoint further than maxError away
+		covered := make([]int, n*n)
+		count, total := 0, 0.0
+		r.triangles(maxError, func(ax, ay, bx, by, cx, cy int) {
+			count++
+			area := float64((bx-ax)*(cy-ay) - (by-ay)*(cx-ax))
+			if area >= 0 {
+				t.Errorf("error %v: triangle %v not counter-clockwise with rows growing upwards", maxError, [6]int{ax, ay, bx, by, cx, cy})
+			}
+			total -= area / 2
+			if abs(ax-cx)+abs(ay-cy) > 1 {
+				mx, my := (ax+bx)/2, (ay+by)/2
+				if d := math.Abs((wave(ax, ay)+wave(bx, by))/2 - wave(mx, my)); d > maxError {
+					t.Errorf("error %v: midpoint %d %d off by %v", maxError, mx, my, d)
+				}
+			}
+			for j := 0; j < n; j++ {
+				for i := 0; i < n; i++ {
+					wa := float64((bx-i)*(cy-j)-(by-j)*(cx-i)) / area
+					wb := float64((cx-i)*(ay-j)-(cy-j)*(ax-i)) / area
+					if wa > 0 && wb > 0 && wa+wb < 1 {
+						covered[j*n+i]++
+					}
+				}
+			}
+		})
+		if total != (n-1)*(n-1) {
+			t.Errorf("error %v: triangles cover %v of %d", maxError, total, (n-1)*(n-1))
+		}
+		for k, c := range covered {
+			// points inside a triangle are covered once, those on edges by none
+			if c > 1 {
+				t.Fatalf("error %v: grid point %d %d inside %d triangles", maxError, k%n, k/n, c)
+			}
+		}
+		if count > last || count > 2*(n-1)*(n-1) {
+			t.Errorf("error %v: %d triangles after %d", maxError, count, last)
+		}
+		last = count
+	}
+	if last != 2 {
+		t.Errorf("%d triangles for a large error, want 2", last)
+	}
+}
+
+func TestRTINFlat(t *testing.T) {
+	for _, size := range []int{3, 33, 513} {
+		r := newRTIN(size, func(i, j int) float64 { return 7 })
+		count := 0
+		r.triangles(0, func(ax, ay, bx, by, cx, cy int) { count++ })
+		if count != 2 {
+			t.Errorf("size %d: %d triangles for a flat grid", size, count)
+		}
+	}
+}
+
+func TestServeTIN(t *testing.T) {
+	defer fakeDevice(1000)()
+	// room for one TIN socket, set before the server runs its handlers
+	defer func(total int) { max_clients = total }(max_clients)
+	max_clients = len(streamClients.list()) + 1
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/tin/stream/", ServeTIN)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/tin/stream/"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"?interval=1", nil)
+	if err == nil || resp == nil || resp.StatusCode != 400 {
+		t.Errorf("interval below min_interval: %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?interval=50", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var mesh tin
+	if err := conn.ReadJSON(&mesh); err != nil || len(mesh.Faces) != 2 {
+		t.Fatalf("flat sand: %d faces, %v", len(mesh.Faces), err)
+	}
+	id := 0
+	for _, info := range streamClients.list() {
+		if info.Kind == kindTIN {
+			id = info.ID
+		}
+	}
+	client, ok := streamClients.get(id)
+	if !ok {
+		t.Fatal("TIN socket not registered")
+	}
+
+	closeCode := func(conn *websocket.Conn) int {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if e, ok := err.(*websocket.CloseError); ok {
+					return e.Code
+				}
+				return 0
+			}
+		}
+	}
+	full, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Close()
+	if code := closeCode(full); code != websocket.CloseTryAgainLater {
+		t.Errorf("over the limit closed with %d", code)
+	}
+
+	client.disconnect()
+	if code := closeCode(conn); code != websocket.ClosePolicyViolation {
+		t.Errorf("disconnected by admin with %d", code)
+	}
+	deviceIdle(t)
+	if _, ok := streamClients.get(id); ok {
+		t.Error("TIN socket still registered")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// trackingInterval is how often circles are detected while anybody listens to events
+const trackingInterval = 500 * time.Millisecond
+
+// trackedCircle is a detected object followed across detections
+type trackedCircle struct {
+	ID int `json:"id"`
+	circle
+}
+
+// circleTracker matches detected circles between frames and publishes
+// circles, enter and leave events
+type circleTracker struct {
+	mutex   sync.Mutex
+	running bool
+	objects []trackedCircle
+	nextID  int
+}
+
+var tracker = &circleTracker{}
+
+// startTracking runs the tracker on the hub until nobody listens to events anymore
+func startTracking() {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if !tracker.running && deviceUsers.enter() {
+		tracker.running = true
+		go tracker.run()
+	}
+}
+
+func (t *circleTracker) run() {
+	defer deviceUsers.leave()
+	ticks := make(chan *hubFrame, 1)
+	defer streamHub.unsubscribe(ticks)
+	streamHub.subscribe(ticks, trackingInterval)
+	for f := range ticks {
+		t.mutex.Lock()
+		if !events.listening() || serverContext.Err() != nil {
+			t.running = false
+			t.objects = nil
+			t.mutex.Unlock()
+			return
+		}
+		t.mutex.Unlock()
+		t.update(f.detect())
+	}
+}
+
+// update matches circles to the tracked objects, nearest first within their radius
+func (t *circleTracker) update(cs []circle) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	matched := make([]bool, len(t.objects))
+	objects := []trackedCircle{}
+	changed := false
+	for _, c := range cs {
+		best := -1
+		bestDistance := math.Inf(1)
+		for i, o := range t.objects {
+			d := math.Hypot(float64(c.X-o.X), float64(c.Y-o.Y))
+			if !matched[i] && d <= math.Max(float64(o.R), 10) && d < bestDistance {
+				best, bestDistance = i, d
+			}
+		}
+		if best < 0 {
+			t.nextID++
+			o := trackedCircle{ID: t.nextID, circle: c}
+			objects = append(objects, o)
+			events.publish("enter", o)
+			changed = true
+			continue
+		}
+		matched[best] = true
+		changed = changed || t.objects[best].circle != c
+		objects = append(objects, trackedCircle{ID: t.objects[best].ID, circle: c})
+	}
+	for i, o := range t.objects {
+		if !matched[i] {
+			events.publish("leave", o)
+			changed = true
+		}
+	}
+	t.objects = objects
+	if changed {
+		events.publish("circles", objects)
+	}
+}